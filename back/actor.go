@@ -0,0 +1,137 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"bomberman-multiplayer/bot"
+	"bomberman-multiplayer/sim"
+)
+
+// Messages a room can have waiting before senders block
+const ROOM_INBOX_SIZE = 256
+
+// A room that is not running yet. Start it with go room.run() once it is
+// registered; from then on its state belongs to that goroutine.
+func newGameRoom(roomID string, maxPlayers int, rules RoomRules) *GameRoom {
+	return &GameRoom{
+		ID:         roomID,
+		Players:    make(map[string]*Player),
+		Sim:        sim.NewState(time.Now().UnixNano(), rules.Rules),
+		State:      "waiting",
+		MaxPlayers: maxPlayers,
+		Rules:      rules,
+		Clients:    make(map[string]*Client),
+		Spectators: make(map[string]*Client),
+		Bots:       make(map[string]*bot.Bot),
+		Recorder:   newReplayRecorder(),
+		Sync:       newStateSync(),
+		inbox:      make(chan func(), ROOM_INBOX_SIZE),
+		done:       make(chan struct{}),
+	}
+}
+
+// The room goroutine: handles joins, leaves, inputs and everything else
+// sent to the inbox one at a time, between its own ticks. Nothing else
+// touches the room's state, so none of it needs a lock.
+func (room *GameRoom) run() {
+	ticker := time.NewTicker(tickDuration())
+	cleanupTicker := time.NewTicker(time.Duration(config.RoomCleanupInterval))
+
+	defer close(room.done)
+	defer ticker.Stop()
+	defer cleanupTicker.Stop()
+
+	for !room.stopped {
+		select {
+		case fn := <-room.inbox:
+			fn()
+		case <-ticker.C:
+			updateRoom(room)
+		case <-cleanupTicker.C:
+			cleanupRoom(room, time.Now())
+		}
+	}
+}
+
+// Queue fn on the room goroutine without waiting for it. Dropped if the
+// room is gone.
+func (room *GameRoom) post(fn func()) {
+	select {
+	case room.inbox <- fn:
+	case <-room.done:
+	}
+}
+
+// Run fn on the room goroutine and wait for it to finish. Returns false,
+// without running fn, if the room is gone.
+func (room *GameRoom) do(fn func()) bool {
+	finished := make(chan struct{})
+	select {
+	case room.inbox <- func() { fn(); close(finished) }:
+	case <-room.done:
+		return false
+	}
+
+	select {
+	case <-finished:
+		return true
+	case <-room.done:
+		// The room may have stopped right after running fn
+		select {
+		case <-finished:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// Take the room off the server and stop its goroutine once the current
+// message is handled. Must run on the room goroutine.
+func removeRoom(room *GameRoom) {
+	roomsMutex.Lock()
+	delete(gameRooms, room.ID)
+	roomsMutex.Unlock()
+
+	closeSpectators(room)
+	room.stopped = true
+}
+
+// Stop every room goroutine, leaving the rooms registered so their clients
+// can still be closed. Used on shutdown, once matches are over.
+func stopRooms() {
+	for _, room := range allRooms() {
+		room.do(func() { room.stopped = true })
+		<-room.done
+	}
+}
+
+// Remove inactive players, and the room once no human is left. Must run on
+// the room goroutine.
+func cleanupRoom(room *GameRoom, now time.Time) {
+	for _, playerID := range sortedPlayerIDs(room) {
+		// Bots never send anything, and disconnected players keep their
+		// slot for the reconnect grace, see expireDisconnectedPlayers
+		player := room.Players[playerID]
+		if _, isBot := room.Bots[playerID]; isBot || player.Disconnected {
+			continue
+		}
+		if now.Sub(player.LastSeen) <= time.Duration(config.PlayerTimeout) {
+			continue
+		}
+
+		dropPlayer(room, playerID)
+		log.Printf("Player %s timed out in room %s", playerID, room.ID)
+
+		broadcastToRoom(room, Message{
+			Type: "playerLeft",
+			Data: PlayerRef{PlayerID: playerID},
+		}, "")
+	}
+
+	if humanCount(room) == 0 {
+		removeRoom(room)
+		log.Printf("Cleaned up empty room: %s", room.ID)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Send queue limits. Past the high-water mark a client is lagging: state
+// updates are skipped and other messages wait in its backlog until the
+// queue drains below the low-water mark. The slots above the high-water
+// mark are kept free for the lagWarning.
+const (
+	SEND_QUEUE_SIZE     = 256
+	LAG_HIGH_WATER      = SEND_QUEUE_SIZE * 3 / 4
+	LAG_LOW_WATER       = SEND_QUEUE_SIZE / 4
+	CLIENT_BACKLOG_SIZE = 64 // Messages held for a lagging client before it is evicted
+)
+
+// State updates that a later message or a resync supersedes, so a lagging
+// client can go without them
+var coalescedMessages = map[string]bool{
+	"playerMoved": true,
+	"bombMoved":   true,
+	"inputAck":    true,
+	"waitTimer":   true,
+	"countdown":   true,
+	"gameState":   true,
+	"stateDelta":  true,
+	"keyframe":    true,
+	"pong":        true,
+}
+
+// Queue a message for writePump without blocking. A lagging client skips
+// state updates, to be resynced once it catches up, while other messages
+// wait in its backlog. Returns whether the message will be sent. Must run
+// on the room goroutine.
+func (c *Client) enqueue(message outgoing, coalesce bool) bool {
+	if c.evicted {
+		return false
+	}
+	if !c.lagging && len(c.Send) >= LAG_HIGH_WATER {
+		c.startLag()
+	}
+
+	if c.lagging {
+		if coalesce {
+			c.stale = true
+			return false
+		}
+		if len(c.backlog) >= CLIENT_BACKLOG_SIZE {
+			c.evict("too many messages waiting")
+			return false
+		}
+		c.backlog = append(c.backlog, message)
+		return true
+	}
+
+	select {
+	case c.Send <- message:
+		return true
+	default:
+		c.evict("send queue full")
+		return false
+	}
+}
+
+// Warn a client that it fell behind, in the slots kept free for it. Must run
+// on the room goroutine.
+func (c *Client) startLag() {
+	c.lagging = true
+	c.lagSince = time.Now()
+
+	log.Printf("Client %s is lagging with %d messages queued", c.PlayerID, len(c.Send))
+
+	msg := Message{Type: "lagWarning", Data: LagWarningData{
+		QueuedMessages: len(c.Send),
+		EvictAfterMs:   time.Duration(config.SlowClientTimeout).Milliseconds(),
+	}}
+	if data, ok := marshalMessage(msg); ok {
+		select {
+		case c.Send <- outgoing{data: data}:
+		default:
+		}
+	}
+}
+
+// Move lagging clients' backlogs into their queues as these drain, resync
+// those that caught up, and evict those that stayed behind too long. Runs
+// every tick. Must run on the room goroutine.
+func relieveSlowClients(room *GameRoom, now time.Time) {
+	for _, clients := range []map[string]*Client{room.Clients, room.Spectators} {
+		for _, client := range clients {
+			if !client.lagging || client.evicted {
+				continue
+			}
+			if now.Sub(client.lagSince) >= time.Duration(config.SlowClientTimeout) {
+				client.evict("too slow to keep up")
+				continue
+			}
+
+			for len(client.backlog) > 0 && len(client.Send) < LAG_HIGH_WATER {
+				client.Send <- client.backlog[0]
+				client.backlog = client.backlog[1:]
+			}
+			if len(client.backlog) > 0 || len(client.Send) > LAG_LOW_WATER {
+				continue
+			}
+
+			client.lagging = false
+			client.backlog = nil
+			log.Printf("Client %s caught up after %s", client.PlayerID, now.Sub(client.lagSince).Round(time.Millisecond))
+
+			// Replace the state updates it went without
+			if client.stale {
+				client.stale = false
+				resync(room, client)
+			}
+		}
+	}
+}
+
+// Disconnect a client that cannot keep up, with a close frame saying why.
+// It can reconnect with its session token. Must run on the room goroutine.
+func (c *Client) evict(reason string) {
+	if c.evicted {
+		return
+	}
+	c.evicted = true
+	c.backlog = nil
+
+	log.Printf("Evicting client %s: %s", c.PlayerID, reason)
+
+	// The close frame waits for writePump's current write, so not here
+	go func() {
+		closeMessage := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, reason)
+		c.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+		c.Conn.Close()
+	}()
+}
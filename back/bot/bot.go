@@ -0,0 +1,263 @@
+// Package bot drives computer players. A bot only reads the simulation
+// state and answers with the same inputs a human client would send, so it
+// follows exactly the same rules.
+package bot
+
+import (
+	"math/rand"
+	"time"
+
+	"bomberman-multiplayer/sim"
+)
+
+type Difficulty string
+
+const (
+	Easy   Difficulty = "easy"
+	Normal Difficulty = "normal"
+	Hard   Difficulty = "hard"
+)
+
+// How a difficulty level plays
+type profile struct {
+	reaction      time.Duration // Delay between two decisions
+	bombChance    float64       // Chance to take a bombing opportunity
+	mistakeChance float64       // Chance to wander in a random direction instead
+	hunt          bool          // Go after players, not only crates and power-ups
+}
+
+var profiles = map[Difficulty]profile{
+	Easy:   {reaction: 450 * time.Millisecond, bombChance: 0.4, mistakeChance: 0.3},
+	Normal: {reaction: 250 * time.Millisecond, bombChance: 0.7, mistakeChance: 0.1, hunt: true},
+	Hard:   {reaction: 120 * time.Millisecond, bombChance: 1, hunt: true},
+}
+
+// Read a difficulty name
+func ParseDifficulty(name string) (Difficulty, bool) {
+	difficulty := Difficulty(name)
+	_, ok := profiles[difficulty]
+	return difficulty, ok
+}
+
+type Bot struct {
+	PlayerID   string
+	Difficulty Difficulty
+	profile    profile
+	rng        *rand.Rand
+	nextThink  time.Duration
+}
+
+// Create a bot for a player. The seed keeps its choices reproducible.
+func New(playerID string, difficulty Difficulty, seed int64) *Bot {
+	return &Bot{
+		PlayerID:   playerID,
+		Difficulty: difficulty,
+		profile:    profiles[difficulty],
+		rng:        rand.New(rand.NewSource(seed)),
+	}
+}
+
+var directions = []struct {
+	name   string
+	dx, dy int
+}{
+	{"up", 0, -1},
+	{"down", 0, 1},
+	{"left", -1, 0},
+	{"right", 1, 0},
+}
+
+// Decide the bot's inputs for the current step
+func (b *Bot) Think(state *sim.State) []sim.Input {
+	if state.Now < b.nextThink {
+		return nil
+	}
+	b.nextThink = state.Now + b.profile.reaction
+
+	player, exists := state.Players[b.PlayerID]
+	if !exists || player.Lives <= 0 {
+		return nil
+	}
+
+	pos := [2]int{player.X, player.Y}
+	step := sim.MoveCooldown(player)
+	danger := state.Danger()
+
+	// Get out of any blast first
+	if _, threatened := danger[pos]; threatened {
+		return b.move(b.escape(state, pos, danger, step))
+	}
+
+	// Drop a bomb when it would hit something and there is a way out
+	if b.bombWorthIt(state, player) && b.rng.Float64() < b.profile.bombChance {
+		if b.escape(state, pos, state.DangerWithBomb(player.X, player.Y, player.ID), step) != "" {
+			return []sim.Input{{PlayerID: b.PlayerID, Type: "bomb"}}
+		}
+	}
+
+	if b.rng.Float64() < b.profile.mistakeChance {
+		return b.move(b.wander(state, pos, danger, step))
+	}
+
+	return b.move(b.seek(state, player, danger, step))
+}
+
+func (b *Bot) move(direction string) []sim.Input {
+	if direction == "" {
+		return nil
+	}
+	return []sim.Input{{PlayerID: b.PlayerID, Type: "move", Direction: direction}}
+}
+
+// Whether a bomb dropped here would break a crate or reach a player
+func (b *Bot) bombWorthIt(state *sim.State, player *sim.Player) bool {
+	for _, cell := range state.BlastCells(player.X, player.Y, state.BlastRange(player.ID)) {
+		x, y := cell[0], cell[1]
+		if state.Map[y][x] == sim.TILE_CRATE {
+			return true
+		}
+		if b.profile.hunt && enemyAt(state, player.ID, x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// One step of a path found by search
+type node struct {
+	pos   [2]int
+	depth int
+	first string // Direction of the first step from the start
+}
+
+// Breadth-first search over tiles that are safe to walk through. Returns the
+// first step towards the nearest tile accepted by goal, or "" if none is
+// reachable. The start tile is accepted too, in which case "" is returned.
+func search(state *sim.State, start [2]int, danger sim.DangerMap, step time.Duration, goal func([2]int) bool) (string, bool) {
+	visited := map[[2]int]bool{start: true}
+	queue := []node{{pos: start}}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if goal(current.pos) {
+			return current.first, true
+		}
+
+		for _, dir := range directions {
+			next := [2]int{current.pos[0] + dir.dx, current.pos[1] + dir.dy}
+			if visited[next] || !state.IsWalkable(next[0], next[1]) {
+				continue
+			}
+
+			// Don't stand on a tile while it explodes
+			arrival := time.Duration(current.depth+1) * step
+			if fuse, threatened := danger[next]; threatened && fuse >= arrival-step && fuse <= arrival+step {
+				continue
+			}
+
+			visited[next] = true
+			first := current.first
+			if first == "" {
+				first = dir.name
+			}
+			queue = append(queue, node{pos: next, depth: current.depth + 1, first: first})
+		}
+	}
+
+	return "", false
+}
+
+// First step towards the nearest tile out of every blast
+func (b *Bot) escape(state *sim.State, pos [2]int, danger sim.DangerMap, step time.Duration) string {
+	direction, _ := search(state, pos, danger, step, func(tile [2]int) bool {
+		_, threatened := danger[tile]
+		return !threatened
+	})
+	return direction
+}
+
+// First step towards something worth bombing or picking up. Hunters go
+// for players first and only farm crates when nobody can be reached.
+func (b *Bot) seek(state *sim.State, player *sim.Player, danger sim.DangerMap, step time.Duration) string {
+	explosionRange := state.BlastRange(player.ID)
+	start := [2]int{player.X, player.Y}
+
+	// Never stop on a tile that is about to explode
+	safe := func(tile [2]int) bool {
+		_, threatened := danger[tile]
+		return !threatened
+	}
+
+	if b.profile.hunt {
+		direction, found := search(state, start, danger, step, func(tile [2]int) bool {
+			if !safe(tile) {
+				return false
+			}
+			for _, cell := range state.BlastCells(tile[0], tile[1], explosionRange) {
+				if enemyAt(state, player.ID, cell[0], cell[1]) {
+					return true
+				}
+			}
+			return false
+		})
+		if found {
+			return direction
+		}
+	}
+
+	direction, _ := search(state, start, danger, step, func(tile [2]int) bool {
+		if !safe(tile) {
+			return false
+		}
+		if powerUpAt(state, tile[0], tile[1]) {
+			return true
+		}
+		for _, cell := range state.BlastCells(tile[0], tile[1], explosionRange) {
+			if state.Map[cell[1]][cell[0]] == sim.TILE_CRATE {
+				return true
+			}
+		}
+		return false
+	})
+	return direction
+}
+
+// A random safe step
+func (b *Bot) wander(state *sim.State, pos [2]int, danger sim.DangerMap, step time.Duration) string {
+	options := []string{}
+	for _, dir := range directions {
+		x, y := pos[0]+dir.dx, pos[1]+dir.dy
+		if !state.IsWalkable(x, y) {
+			continue
+		}
+		if fuse, threatened := danger[[2]int{x, y}]; threatened && fuse <= 2*step {
+			continue
+		}
+		options = append(options, dir.name)
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	return options[b.rng.Intn(len(options))]
+}
+
+// Whether another living player who can be hurt stands at (x, y)
+func enemyAt(state *sim.State, playerID string, x, y int) bool {
+	for _, other := range state.Players {
+		if other.ID != playerID && other.Lives > 0 && !state.Invulnerable(other) && other.X == x && other.Y == y {
+			return true
+		}
+	}
+	return false
+}
+
+func powerUpAt(state *sim.State, x, y int) bool {
+	for _, powerUp := range state.PowerUps {
+		if powerUp.X == x && powerUp.Y == y {
+			return true
+		}
+	}
+	return false
+}
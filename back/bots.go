@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"bomberman-multiplayer/bot"
+	"bomberman-multiplayer/sim"
+)
+
+// Bot defaults, overridden by the server config
+const (
+	AUTO_FILL_BOTS         = true // Fill free slots with bots when the waiting timer runs out
+	DEFAULT_BOT_DIFFICULTY = bot.Normal
+)
+
+// Add a bot player to a waiting room. Must run on the room goroutine.
+func addBotToRoom(room *GameRoom, difficulty bot.Difficulty) *Player {
+	if len(room.Players) >= room.MaxPlayers {
+		return nil
+	}
+
+	// Bots get the same kind of ID as humans, so clients can't tell them apart
+	playerID := newPlayerID(room)
+	name := fmt.Sprintf("Bot-%d", len(room.Bots)+1)
+
+	player := &Player{
+		Player:   room.Sim.AddPlayer(playerID, name),
+		LastSeen: time.Now(),
+	}
+	room.Players[playerID] = player
+	room.Bots[playerID] = bot.New(playerID, difficulty, room.Sim.Seed+int64(len(room.Bots)+1))
+
+	log.Printf("Bot %s (%s, %s) joined room %s", name, playerID, difficulty, room.ID)
+
+	broadcastToRoom(room, Message{
+		Type: "playerJoined",
+		Data: player,
+		From: playerID,
+	}, "")
+
+	scheduleStart(room)
+
+	return player
+}
+
+// Number of players in the room who are not bots. Must run on the room goroutine.
+func humanCount(room *GameRoom) int {
+	return len(room.Players) - len(room.Bots)
+}
+
+// Whether the room may be topped up with bots. Must run on the room goroutine.
+func canFillWithBots(room *GameRoom) bool {
+	return config.AutoFillBots && humanCount(room) > 0
+}
+
+// Fill every free slot with a bot. Must run on the room goroutine.
+func fillWithBots(room *GameRoom) {
+	for len(room.Players) < room.MaxPlayers {
+		if addBotToRoom(room, config.botDifficulty()) == nil {
+			return
+		}
+	}
+}
+
+// Collect this step's inputs from the room's bots. Must run on the room goroutine.
+func botInputs(room *GameRoom) []sim.Input {
+	botIDs := make([]string, 0, len(room.Bots))
+	for botID := range room.Bots {
+		botIDs = append(botIDs, botID)
+	}
+	sort.Strings(botIDs)
+
+	inputs := []sim.Input{}
+	for _, botID := range botIDs {
+		for _, input := range room.Bots[botID].Think(room.Sim) {
+			room.Recorder.RecordInput(input, room.Sim.Tick)
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs
+}
+
+// Leave bots out of the leaderboard
+func humanResults(room *GameRoom, results []sim.PlayerResult) []sim.PlayerResult {
+	humans := []sim.PlayerResult{}
+	for _, result := range results {
+		if _, isBot := room.Bots[result.PlayerID]; !isBot {
+			humans = append(humans, result)
+		}
+	}
+	return humans
+}
+
+// POST /rooms/{id}/bots : add bots to a waiting room
+func addBots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	room := getRoom(mux.Vars(r)["id"])
+	if room == nil {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+
+	// Parse request body (optional)
+	var requestData struct {
+		Count      int    `json:"count"`
+		Difficulty string `json:"difficulty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if requestData.Count == 0 {
+		requestData.Count = 1
+	}
+	if requestData.Count < 0 {
+		http.Error(w, "count must be positive", http.StatusBadRequest)
+		return
+	}
+
+	difficulty := config.botDifficulty()
+	if requestData.Difficulty != "" {
+		parsed, ok := bot.ParseDifficulty(requestData.Difficulty)
+		if !ok {
+			http.Error(w, "difficulty must be easy, normal or hard", http.StatusBadRequest)
+			return
+		}
+		difficulty = parsed
+	}
+
+	// Checked and added on the room goroutine, so no player can take the slots in between
+	var data []byte
+	var err error
+	refused := ""
+	ran := room.do(func() {
+		if room.State != "waiting" {
+			refused = "Bots can only join a waiting room"
+			return
+		}
+		if len(room.Players)+requestData.Count > room.MaxPlayers {
+			refused = "Not enough free slots"
+			return
+		}
+
+		added := make([]*Player, 0, requestData.Count)
+		for i := 0; i < requestData.Count; i++ {
+			added = append(added, addBotToRoom(room, difficulty))
+		}
+		data, err = json.Marshal(added)
+	})
+
+	if !ran {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	if refused != "" {
+		http.Error(w, refused, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A room opened by a player on /ws has no waiting timer yet. Bots added
+// through the API must start it, or the countdown once the room is full.
+func TestBotsStartRoom(t *testing.T) {
+	tests := []struct {
+		name      string
+		bots      int
+		wantState string // Right after the bots joined
+	}{
+		{"with a free slot left", 1, "waiting"},
+		{"filling the room", 3, "countdown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestServer(t)
+			config.AutoFillBots = false
+
+			server := httptest.NewServer(newRouter())
+			defer server.Close()
+
+			room := getOrCreateRoom("")
+			defer func() {
+				room.do(func() { removeRoom(room) })
+				<-room.done
+			}()
+			room.do(func() { addPlayerToRoom(room, nil, "Alice") })
+
+			body := strings.NewReader(fmt.Sprintf(`{"count": %d}`, tt.bots))
+			resp, err := http.Post(server.URL+"/rooms/"+room.ID+"/bots", "application/json", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusCreated {
+				t.Fatalf("adding bots: status %d", resp.StatusCode)
+			}
+
+			state, waitStarted := "", false
+			room.do(func() { state, waitStarted = room.State, !room.StartTime.IsZero() })
+			if state != tt.wantState || !waitStarted && state == "waiting" {
+				t.Fatalf("room is %s (waiting timer started: %v), want %s", state, waitStarted, tt.wantState)
+			}
+
+			// Waiting timer and countdown are short in tests
+			deadline := time.Now().Add(time.Duration(config.Waiting) + time.Duration(config.Countdown) + time.Second)
+			for state != "playing" {
+				if time.Now().After(deadline) {
+					t.Fatalf("room still %s, the match never started", state)
+				}
+				time.Sleep(10 * time.Millisecond)
+				room.do(func() { state = room.State })
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"bomberman-multiplayer/bot"
+)
+
+// Préfixe des variables d'environnement (BOMBERMAN_ADDR, BOMBERMAN_TICK_RATE...)
+const CONFIG_ENV_PREFIX = "BOMBERMAN_"
+
+// Configuration du serveur. Ordre de priorité, du plus faible au plus fort :
+// valeurs par défaut, fichier YAML/JSON, variables d'environnement, options
+// de la ligne de commande.
+type Config struct {
+	Addr                string     `json:"addr" yaml:"addr"`
+	Store               string     `json:"store" yaml:"store"` // "json" ou "sqlite"
+	ScoresFile          string     `json:"scoresFile" yaml:"scoresFile"`
+	ScoresDBFile        string     `json:"scoresDbFile" yaml:"scoresDbFile"`
+	ReplaysDir          string     `json:"replaysDir" yaml:"replaysDir"`
+	TickRate            int        `json:"tickRate" yaml:"tickRate"`
+	PlayerTimeout       Duration   `json:"playerTimeout" yaml:"playerTimeout"`
+	RoomCleanupInterval Duration   `json:"roomCleanupInterval" yaml:"roomCleanupInterval"`
+	ReconnectGrace      Duration   `json:"reconnectGrace" yaml:"reconnectGrace"`
+	Countdown           Duration   `json:"countdown" yaml:"countdown"`           // Valeur par défaut des salons
+	Waiting             Duration   `json:"waiting" yaml:"waiting"`               // Valeur par défaut des salons
+	AllowedOrigins      stringList `json:"allowedOrigins" yaml:"allowedOrigins"` // Vide ou "*" : toutes les origines
+	AutoFillBots        bool       `json:"autoFillBots" yaml:"autoFillBots"`
+	BotDifficulty       string     `json:"botDifficulty" yaml:"botDifficulty"`
+	ShutdownTimeout     Duration   `json:"shutdownTimeout" yaml:"shutdownTimeout"`         // Temps laissé aux parties en cours
+	SlowClientTimeout   Duration   `json:"slowClientTimeout" yaml:"slowClientTimeout"`     // Retard toléré avant de déconnecter un client
+	FinishedRoomTimeout Duration   `json:"finishedRoomTimeout" yaml:"finishedRoomTimeout"` // Temps d'affichage des résultats avant de fermer le salon
+}
+
+// Configuration en cours (les valeurs par défaut tant que loadConfig n'a pas été appelé)
+var config = defaultConfig()
+
+func defaultConfig() Config {
+	return Config{
+		Addr:                ":8080",
+		Store:               "json",
+		ScoresFile:          SCORES_FILE,
+		ScoresDBFile:        SCORES_DB_FILE,
+		ReplaysDir:          REPLAYS_DIR,
+		TickRate:            GAME_TICK_RATE,
+		PlayerTimeout:       Duration(PLAYER_TIMEOUT),
+		RoomCleanupInterval: Duration(ROOM_CLEANUP_INTERVAL),
+		ReconnectGrace:      Duration(RECONNECT_GRACE_PERIOD),
+		Countdown:           Duration(COUNTDOWN_DURATION),
+		Waiting:             Duration(WAITING_DURATION),
+		FinishedRoomTimeout: Duration(FINISHED_ROOM_TIMEOUT),
+		AutoFillBots:        AUTO_FILL_BOTS,
+		BotDifficulty:       string(DEFAULT_BOT_DIFFICULTY),
+		ShutdownTimeout:     Duration(SHUTDOWN_TIMEOUT),
+		SlowClientTimeout:   Duration(SLOW_CLIENT_TIMEOUT),
+	}
+}
+
+// Durée écrite "30s", "1m30s"... dans les fichiers, l'environnement et les options
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+// Liste séparée par des virgules dans l'environnement et les options
+type stringList []string
+
+func (l stringList) String() string {
+	return strings.Join(l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// Déclarer une option par champ de la configuration, avec la valeur actuelle par défaut
+func (c *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Addr, "addr", c.Addr, "address the HTTP server listens on")
+	fs.StringVar(&c.Store, "store", c.Store, "score storage backend: json or sqlite")
+	fs.StringVar(&c.ScoresFile, "scores-file", c.ScoresFile, "JSON scores file")
+	fs.StringVar(&c.ScoresDBFile, "scores-db", c.ScoresDBFile, "SQLite scores database")
+	fs.StringVar(&c.ReplaysDir, "replays-dir", c.ReplaysDir, "directory for match replays")
+	fs.IntVar(&c.TickRate, "tick-rate", c.TickRate, "game updates per second")
+	fs.Var(&c.PlayerTimeout, "player-timeout", "drop players silent for this long")
+	fs.Var(&c.RoomCleanupInterval, "room-cleanup-interval", "how often inactive rooms are cleaned up")
+	fs.Var(&c.ReconnectGrace, "reconnect-grace", "how long a dropped player's slot is kept during a match")
+	fs.Var(&c.Countdown, "countdown", "default countdown before a match")
+	fs.Var(&c.Waiting, "waiting", "default wait for more players before the countdown")
+	fs.Var(&c.FinishedRoomTimeout, "finished-room-timeout", "how long a finished room stays open before it is cleaned up")
+	fs.Var(&c.AllowedOrigins, "allowed-origins", "comma-separated WebSocket origins, empty or * for any")
+	fs.BoolVar(&c.AutoFillBots, "auto-fill-bots", c.AutoFillBots, "fill free slots with bots when the waiting timer runs out")
+	fs.StringVar(&c.BotDifficulty, "bot-difficulty", c.BotDifficulty, "difficulty of auto-filled bots: easy, normal or hard")
+	fs.Var(&c.ShutdownTimeout, "shutdown-timeout", "how long running matches may continue after SIGINT/SIGTERM")
+	fs.Var(&c.SlowClientTimeout, "slow-client-timeout", "how long a client may lag behind before it is disconnected")
+}
+
+// Nom de la variable d'environnement d'une option ("tick-rate" -> BOMBERMAN_TICK_RATE)
+func envName(flagName string) string {
+	return CONFIG_ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Charger la configuration depuis le fichier, l'environnement et les options
+func loadConfig(args []string) (Config, error) {
+	cfg := defaultConfig()
+
+	// Le fichier est lu avant de déclarer les options, pour qu'elles le surchargent
+	path := configPath(args)
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return cfg, fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	fs := flag.NewFlagSet("bomberman", flag.ContinueOnError)
+	fs.String("config", path, "YAML or JSON config file (env "+envName("config")+")")
+	cfg.bindFlags(fs)
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || f.Name == "config" || envErr != nil {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			envErr = fmt.Errorf("%s: %w", envName(f.Name), err)
+		}
+	})
+	if envErr != nil {
+		return cfg, envErr
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.validate()
+}
+
+// Chemin du fichier de configuration : option -config, sinon BOMBERMAN_CONFIG
+func configPath(args []string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv(envName("config"))
+}
+
+// Lire un fichier YAML ou JSON selon son extension. Les clés inconnues sont refusées.
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(c)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(file)
+		decoder.KnownFields(true)
+		return decoder.Decode(c)
+	}
+	return fmt.Errorf("unsupported format, use .yaml, .yml or .json")
+}
+
+// Vérifier la configuration au démarrage
+func (c Config) validate() error {
+	problems := []string{}
+
+	if c.Addr == "" {
+		problems = append(problems, "addr is required")
+	}
+	if c.Store != "json" && c.Store != "sqlite" {
+		problems = append(problems, "store must be json or sqlite")
+	}
+	if c.ScoresFile == "" || c.ScoresDBFile == "" || c.ReplaysDir == "" {
+		problems = append(problems, "scores-file, scores-db and replays-dir are required")
+	}
+	if c.TickRate < 1 || c.TickRate > 240 {
+		problems = append(problems, "tick-rate must be between 1 and 240")
+	}
+	if c.PlayerTimeout <= 0 || c.RoomCleanupInterval <= 0 || c.ReconnectGrace <= 0 || c.ShutdownTimeout <= 0 || c.SlowClientTimeout <= 0 || c.FinishedRoomTimeout <= 0 {
+		problems = append(problems, "player-timeout, room-cleanup-interval, reconnect-grace, finished-room-timeout, shutdown-timeout and slow-client-timeout must be positive")
+	}
+	if c.ReconnectGrace >= c.PlayerTimeout {
+		problems = append(problems, "reconnect-grace must be shorter than player-timeout")
+	}
+	if countdown := time.Duration(c.Countdown); countdown < MIN_COUNTDOWN || countdown > MAX_COUNTDOWN {
+		problems = append(problems, fmt.Sprintf("countdown must be between %s and %s", MIN_COUNTDOWN, MAX_COUNTDOWN))
+	}
+	if waiting := time.Duration(c.Waiting); waiting < 0 || waiting > MAX_WAITING {
+		problems = append(problems, fmt.Sprintf("waiting must be between 0s and %s", MAX_WAITING))
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if parsed, err := url.Parse(origin); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problems = append(problems, fmt.Sprintf("allowed origin %q must look like https://example.com", origin))
+		}
+	}
+	if _, ok := bot.ParseDifficulty(c.BotDifficulty); !ok {
+		problems = append(problems, "bot-difficulty must be easy, normal or hard")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Afficher la configuration effective
+func (c Config) Print() {
+	fmt.Println("Effective configuration:")
+	fs := flag.NewFlagSet("print", flag.ContinueOnError)
+	c.bindFlags(fs)
+	fs.VisitAll(func(f *flag.Flag) {
+		fmt.Printf("  %-22s %s\n", f.Name, f.Value)
+	})
+}
+
+// Vérifier l'origine d'une connexion WebSocket
+func checkOrigin(r *http.Request) bool {
+	if len(config.AllowedOrigins) == 0 {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	for _, allowed := range config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Difficulté des bots ajoutés automatiquement
+func (c Config) botDifficulty() bot.Difficulty {
+	difficulty, _ := bot.ParseDifficulty(c.BotDifficulty)
+	return difficulty
+}
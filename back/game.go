@@ -1,32 +1,38 @@
 package main
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
-	"math/rand"
+	"sort"
 	"time"
+
+	"bomberman-multiplayer/sim"
 )
 
-// Game constants
+// Game defaults, overridden by the server config
 const (
-	GAME_TICK_RATE     = 60 // 60 FPS
-	ROOM_CLEANUP_INTERVAL = 30 * time.Second
-	PLAYER_TIMEOUT     = 60 * time.Second
-	COUNTDOWN_DURATION = 10 * time.Second
-	WAITING_DURATION   = 20 * time.Second
-	MAP_WIDTH         = 15
-	MAP_HEIGHT        = 13
+	GAME_TICK_RATE         = 60 // 60 FPS
+	ROOM_CLEANUP_INTERVAL  = 30 * time.Second
+	PLAYER_TIMEOUT         = 60 * time.Second
+	COUNTDOWN_DURATION     = 10 * time.Second
+	WAITING_DURATION       = 20 * time.Second
+	RECONNECT_GRACE_PERIOD = 30 * time.Second // How long a dropped player's slot is kept during a match
+	SLOW_CLIENT_TIMEOUT    = 10 * time.Second // How long a client may lag behind before it is disconnected
+	FINISHED_ROOM_TIMEOUT  = 30 * time.Second // How long a finished room stays open for its results
 )
 
 // Create or get existing room
 func getOrCreateRoom(roomID string) *GameRoom {
-	roomsMutex.Lock()
-	defer roomsMutex.Unlock()
-
 	// If no specific room requested, find available room
 	if roomID == "" {
-		for _, room := range gameRooms {
-			if len(room.Players) < room.MaxPlayers && room.State == "waiting" {
+		for _, room := range allRooms() {
+			available := false
+			room.do(func() {
+				available = len(room.Players) < room.MaxPlayers && room.State == "waiting"
+			})
+			if available {
 				return room
 			}
 		}
@@ -35,118 +41,142 @@ func getOrCreateRoom(roomID string) *GameRoom {
 	}
 
 	// Get existing room or create new one
+	roomsMutex.Lock()
 	room, exists := gameRooms[roomID]
 	if !exists {
-		room = &GameRoom{
-			ID:         roomID,
-			Players:    make(map[string]*Player),
-			Bombs:      make(map[string]*Bomb),
-			Map:        generateMap(),
-			State:      "waiting",
-			MaxPlayers: 4,
-			Clients:    make(map[string]*Client),
-		}
+		room = newGameRoom(roomID, 4, defaultRoomRules())
 		gameRooms[roomID] = room
+		go room.run()
 		log.Printf("Created new room: %s", roomID)
 	}
+	roomsMutex.Unlock()
 
 	// Check if room is full
-	if len(room.Players) >= room.MaxPlayers {
+	full := true
+	room.do(func() {
+		full = len(room.Players) >= room.MaxPlayers
+	})
+	if full {
 		return nil
 	}
 
 	return room
 }
 
-// Add player to room
+// Add player to room. Must run on the room goroutine.
 func addPlayerToRoom(room *GameRoom, client *Client, playerName string) *Player {
-	room.mutex.Lock()
-	defer room.mutex.Unlock()
-
 	if len(room.Players) >= room.MaxPlayers {
 		return nil
 	}
 
-	// Generate unique player ID
-	playerID := fmt.Sprintf("player_%d", time.Now().UnixNano())
+	playerID := newPlayerID(room)
 
-	// Get spawn position
-	spawnX, spawnY := getSpawnPosition(room, len(room.Players))
-
-	// Create player
+	// Create player at the next spawn point
 	player := &Player{
-		ID:    playerID,
-		Name:  playerName,
-		X:     spawnX,
-		Y:     spawnY,
-		Lives: 3,
-		Score: 0,
-		PowerUps: PowerUps{
-			Bombs:  0,
-			Flames: 0,
-			Speed:  0,
-		},
-		LastSeen: time.Now(),
+		Player:       room.Sim.AddPlayer(playerID, playerName),
+		SessionToken: generateSessionToken(),
+		LastSeen:     time.Now(),
 	}
 
 	room.Players[playerID] = player
+	scheduleStart(room)
+
+	return player
+}
+
+// Start the countdown or the waiting timer once a waiting room has enough
+// players, humans and bots alike. Must run on the room goroutine.
+func scheduleStart(room *GameRoom) {
+	if room.State != "waiting" {
+		return
+	}
 
-	// Check if we should start countdown
 	playerCount := len(room.Players)
-	if room.State == "waiting" {
-		if playerCount >= 4 {
-			// Start countdown immediately with 4 players
-			startCountdown(room)
-		} else if playerCount >= 2 && room.StartTime.IsZero() {
-			// Start waiting timer with 2+ players
-			room.StartTime = time.Now()
-		}
+	if playerCount >= 4 {
+		// Start countdown immediately with 4 players
+		startCountdown(room)
+	} else if (playerCount >= 2 || canFillWithBots(room)) && room.StartTime.IsZero() {
+		// Start waiting timer with 2+ players, or 1 if bots can fill the room
+		room.StartTime = time.Now()
 	}
+}
 
-	return player
+// Next player ID in the room. IDs come from a counter rather than the clock,
+// so a replay's recorded inputs map to the same players. Must run on the
+// room goroutine.
+func newPlayerID(room *GameRoom) string {
+	room.lastPlayerID++
+	return fmt.Sprintf("player_%d", room.lastPlayerID)
 }
 
-// Remove player from room
+// Remove player from room. Must run on the room goroutine.
 func removePlayerFromRoom(room *GameRoom, playerID string) {
-	room.mutex.Lock()
-	defer room.mutex.Unlock()
-
 	// Remove player
-	delete(room.Players, playerID)
-	delete(room.Clients, playerID)
+	dropPlayer(room, playerID)
 
 	log.Printf("Player %s left room %s", playerID, room.ID)
 
 	// Notify other players
 	broadcastToRoom(room, Message{
 		Type: "playerLeft",
-		Data: map[string]string{"playerId": playerID},
+		Data: PlayerRef{PlayerID: playerID},
 	}, "")
 
-	// Check if room should be cleaned up
-	if len(room.Players) == 0 {
-		roomsMutex.Lock()
-		delete(gameRooms, room.ID)
-		roomsMutex.Unlock()
+	// Check if room should be cleaned up (bots alone don't keep it open)
+	if humanCount(room) == 0 {
+		removeRoom(room)
 		log.Printf("Room %s deleted - no players", room.ID)
 		return
 	}
 
 	// Check if game should end
+	if room.State == "playing" && room.Sim.Over() {
+		endGame(room)
+	}
+}
+
+// Remove a player from the room and its simulation. A player leaving a
+// running match forfeits it, so it still gets a result. Must run on the
+// room goroutine.
+func dropPlayer(room *GameRoom, playerID string) {
+	delete(room.Players, playerID)
+	delete(room.Clients, playerID)
+	delete(room.Bots, playerID)
 	if room.State == "playing" {
-		alivePlayers := 0
-		for _, player := range room.Players {
-			if player.Lives > 0 {
-				alivePlayers++
-			}
-		}
-		if alivePlayers <= 1 {
-			endGame(room)
+		room.Sim.Forfeit(playerID)
+	} else {
+		room.Sim.RemovePlayer(playerID)
+	}
+}
+
+// Random token that lets a client reclaim its player after a dropped connection
+func generateSessionToken() string {
+	buf := make([]byte, 16)
+	if _, err := cryptorand.Read(buf); err != nil {
+		log.Printf("Error generating session token: %v", err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Remove players whose reconnect grace period ran out. Must run on the room goroutine.
+func expireDisconnectedPlayers(room *GameRoom, now time.Time) {
+	for _, playerID := range sortedPlayerIDs(room) {
+		player := room.Players[playerID]
+		if !player.Disconnected || now.Sub(player.DisconnectedAt) <= time.Duration(config.ReconnectGrace) {
+			continue
 		}
+
+		dropPlayer(room, playerID)
+		log.Printf("Player %s did not reconnect to room %s", playerID, room.ID)
+
+		broadcastToRoom(room, Message{
+			Type: "playerLeft",
+			Data: PlayerRef{PlayerID: playerID},
+		}, "")
 	}
 }
 
-// Start countdown before game begins
+// Start countdown before game begins. Must run on the room goroutine.
 func startCountdown(room *GameRoom) {
 	room.State = "countdown"
 	room.CountdownStart = time.Now()
@@ -154,53 +184,57 @@ func startCountdown(room *GameRoom) {
 	// Notify players
 	broadcastToRoom(room, Message{
 		Type: "countdown",
-		Data: map[string]interface{}{
-			"duration": COUNTDOWN_DURATION.Milliseconds(),
-		},
+		Data: CountdownData{Duration: room.Rules.CountdownMs},
 	}, "")
 
 	log.Printf("Starting countdown for room %s", room.ID)
 }
 
-// Start the actual game
+// Send a room counting down back to waiting. Must run on the room goroutine.
+func cancelCountdown(room *GameRoom) {
+	room.State = "waiting"
+	room.CountdownStart = time.Time{}
+
+	broadcastToRoom(room, Message{Type: "gameState", Data: gameStateData(room)}, "")
+
+	log.Printf("Countdown cancelled for room %s", room.ID)
+}
+
+// Start the actual game. Must run on the room goroutine.
 func startGame(room *GameRoom) {
-	room.mutex.Lock()
 	room.State = "playing"
 	room.StartTime = time.Now()
-	room.mutex.Unlock()
 
 	// Notify players
 	broadcastToRoom(room, Message{
 		Type: "gameStarted",
-		Data: map[string]interface{}{
-			"state": "playing",
-		},
+		Data: GameStartedData{State: "playing"},
 	}, "")
 
 	log.Printf("Game started in room %s with %d players", room.ID, len(room.Players))
 }
 
-// End the game
+// End the game. Must run on the room goroutine.
 func endGame(room *GameRoom) {
-	room.mutex.Lock()
 	room.State = "finished"
-	room.mutex.Unlock()
 
 	// Find winner
-	var winner *Player
-	for _, player := range room.Players {
-		if player.Lives > 0 {
-			winner = player
-			break
-		}
-	}
+	winner, results := room.Sim.Finish()
+
+	// Record results in the leaderboard
+	pendingWrites.Add(1)
+	go func(results []sim.PlayerResult, duration time.Duration) {
+		defer pendingWrites.Done()
+		recordMatchResults(results, duration)
+	}(humanResults(room, results), time.Since(room.StartTime))
 
 	// Notify players
-	winnerData := map[string]interface{}{
-		"state": "finished",
+	winnerData := GameEndedData{
+		State:   "finished",
+		Results: results,
 	}
 	if winner != nil {
-		winnerData["winner"] = winner
+		winnerData.Winner = room.Players[winner.ID]
 	}
 
 	broadcastToRoom(room, Message{
@@ -210,350 +244,152 @@ func endGame(room *GameRoom) {
 
 	log.Printf("Game ended in room %s", room.ID)
 
-	// Schedule room cleanup
+	// Schedule room cleanup, saving the replay once the last broadcasts are recorded
+	pendingWrites.Add(1)
 	go func() {
-		time.Sleep(30 * time.Second)
-		roomsMutex.Lock()
-		delete(gameRooms, room.ID)
-		roomsMutex.Unlock()
-		log.Printf("Room %s cleaned up", room.ID)
-	}()
-}
-
-// Get spawn position for player based on player index
-func getSpawnPosition(room *GameRoom, playerIndex int) (int, int) {
-	// Spawn positions in corners
-	spawns := [][]int{
-		{1, 1},                           // Top-left
-		{MAP_WIDTH - 2, 1},               // Top-right  
-		{1, MAP_HEIGHT - 2},              // Bottom-left
-		{MAP_WIDTH - 2, MAP_HEIGHT - 2},  // Bottom-right
-	}
-
-	if playerIndex < len(spawns) {
-		return spawns[playerIndex][0], spawns[playerIndex][1]
-	}
-
-	// Fallback to center if more than 4 players
-	return MAP_WIDTH / 2, MAP_HEIGHT / 2
-}
-
-// Generate a basic bomberman map
-func generateMap() [][]int {
-	gameMap := make([][]int, MAP_HEIGHT)
-	for i := range gameMap {
-		gameMap[i] = make([]int, MAP_WIDTH)
-	}
-
-	// Create outer walls
-	for y := 0; y < MAP_HEIGHT; y++ {
-		for x := 0; x < MAP_WIDTH; x++ {
-			if x == 0 || x == MAP_WIDTH-1 || y == 0 || y == MAP_HEIGHT-1 {
-				gameMap[y][x] = 1 // Wall
-			}
+		defer pendingWrites.Done()
+		select {
+		case <-time.After(time.Duration(config.FinishedRoomTimeout)):
+		case <-shutdownNow:
 		}
-	}
-
-	// Create inner wall pattern (every other cell in grid)
-	for y := 2; y < MAP_HEIGHT-2; y += 2 {
-		for x := 2; x < MAP_WIDTH-2; x += 2 {
-			gameMap[y][x] = 1 // Wall
+		saveReplay(room, results)
+		if room.do(func() { removeRoom(room) }) {
+			log.Printf("Room %s cleaned up", room.ID)
 		}
-	}
-
-	// Add random destructible blocks (2 = destructible)
-	rand.Seed(time.Now().UnixNano())
-	for y := 1; y < MAP_HEIGHT-1; y++ {
-		for x := 1; x < MAP_WIDTH-1; x++ {
-			if gameMap[y][x] == 0 {
-				// Don't place blocks near spawn points
-				if isNearSpawn(x, y) {
-					continue
-				}
-				// 60% chance for destructible block
-				if rand.Float32() < 0.6 {
-					gameMap[y][x] = 2
-				}
-			}
-		}
-	}
-
-	return gameMap
+	}()
 }
 
-// Check if position is near spawn points
-func isNearSpawn(x, y int) bool {
-	spawns := [][]int{
-		{1, 1}, {MAP_WIDTH - 2, 1},
-		{1, MAP_HEIGHT - 2}, {MAP_WIDTH - 2, MAP_HEIGHT - 2},
-	}
-
-	for _, spawn := range spawns {
-		dx := abs(x - spawn[0])
-		dy := abs(y - spawn[1])
-		if dx <= 1 && dy <= 1 {
-			return true
+// Save every participant of a finished match to the leaderboard, with the
+// same name rules as submitted scores
+func recordMatchResults(results []sim.PlayerResult, duration time.Duration) {
+	entries := make([]scoreToSend, 0, len(results))
+	for _, result := range results {
+		name, problem := validateName(result.Name)
+		if problem != "" {
+			log.Printf("Not recording the score of %s: name %s", result.PlayerID, problem)
+			continue
 		}
+		entries = append(entries, scoreToSend{
+			Name:      name,
+			Score:     result.Score,
+			Time:      formatMatchTime(duration),
+			Mode:      "multiplayer",
+			Placement: result.Placement,
+		})
 	}
-	return false
-}
 
-// Absolute value helper
-func abs(x int) int {
-	if x < 0 {
-		return -x
-	}
-	return x
-}
-
-// Main game loop that runs for all rooms
-func gameTickLoop() {
-	ticker := time.NewTicker(time.Second / GAME_TICK_RATE)
-	cleanupTicker := time.NewTicker(ROOM_CLEANUP_INTERVAL)
-
-	defer ticker.Stop()
-	defer cleanupTicker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			updateAllRooms()
-		case <-cleanupTicker.C:
-			cleanupInactiveRooms()
-		}
-	}
+	recordScores(entries...)
 }
 
-// Update all game rooms
-func updateAllRooms() {
-	roomsMutex.RLock()
-	rooms := make([]*GameRoom, 0, len(gameRooms))
-	for _, room := range gameRooms {
-		rooms = append(rooms, room)
-	}
-	roomsMutex.RUnlock()
-
-	for _, room := range rooms {
-		updateRoom(room)
-	}
+// Format a match duration as m:ss, like the solo leaderboard
+func formatMatchTime(duration time.Duration) string {
+	seconds := int(duration.Seconds())
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
 }
 
-// Update individual room
+// Update individual room, once per tick. Must run on the room goroutine.
 func updateRoom(room *GameRoom) {
-	room.mutex.Lock()
-	defer room.mutex.Unlock()
-
 	now := time.Now()
 
+	expireDisconnectedPlayers(room, now)
+
 	switch room.State {
 	case "waiting":
+		// No new matches once the server is shutting down
+		if shuttingDown.Load() {
+			break
+		}
+
 		// Check if we should start countdown
-		if len(room.Players) >= 2 && !room.StartTime.IsZero() {
+		if (len(room.Players) >= 2 || canFillWithBots(room)) && !room.StartTime.IsZero() {
 			timeElapsed := now.Sub(room.StartTime)
-			if timeElapsed >= WAITING_DURATION {
-				room.State = "countdown"
-				room.CountdownStart = now
-				
-				// Notify outside of lock
-				go broadcastToRoom(room, Message{
-					Type: "countdown",
-					Data: map[string]interface{}{
-						"duration": COUNTDOWN_DURATION.Milliseconds(),
-					},
-				}, "")
+			if timeElapsed >= room.Rules.Waiting() || len(room.Players) >= room.MaxPlayers {
+				// Give the free slots to bots, which starts the countdown once the room is full
+				if canFillWithBots(room) {
+					fillWithBots(room)
+				}
+				if room.State == "waiting" {
+					startCountdown(room)
+				}
 			} else {
 				// Send wait timer updates every second
 				if int(timeElapsed.Seconds()) != int((timeElapsed - time.Second).Seconds()) {
-					timeRemaining := WAITING_DURATION - timeElapsed
-					go broadcastToRoom(room, Message{
+					timeRemaining := room.Rules.Waiting() - timeElapsed
+					broadcastToRoom(room, Message{
 						Type: "waitTimer",
-						Data: map[string]interface{}{
-							"timeRemaining": timeRemaining.Milliseconds(),
-						},
+						Data: WaitTimerData{TimeRemaining: timeRemaining.Milliseconds()},
 					}, "")
 				}
 			}
 		}
 
 	case "countdown":
+		// A match that has not started yet is called off on shutdown
+		if shuttingDown.Load() {
+			cancelCountdown(room)
+			break
+		}
+
 		// Check if countdown is finished
 		timeElapsed := now.Sub(room.CountdownStart)
-		if timeElapsed >= COUNTDOWN_DURATION {
+		if timeElapsed >= room.Rules.Countdown() {
 			room.State = "playing"
 			room.StartTime = now
-			
-			// Notify outside of lock
-			go broadcastToRoom(room, Message{
+			room.LastTick = now
+			room.Recorder.RecordSnapshot(gameStateData(room))
+
+			broadcastToRoom(room, Message{
 				Type: "gameStarted",
-				Data: map[string]interface{}{
-					"state": "playing",
-				},
+				Data: GameStartedData{State: "playing"},
 			}, "")
 		} else {
 			// Send countdown updates every second
 			if int(timeElapsed.Seconds()) != int((timeElapsed - time.Second).Seconds()) {
-				timeRemaining := COUNTDOWN_DURATION - timeElapsed
-				go broadcastToRoom(room, Message{
+				timeRemaining := room.Rules.Countdown() - timeElapsed
+				broadcastToRoom(room, Message{
 					Type: "countdown",
-					Data: map[string]interface{}{
-						"timeRemaining": timeRemaining.Milliseconds(),
-					},
+					Data: CountdownData{TimeRemaining: timeRemaining.Milliseconds()},
 				}, "")
 			}
 		}
 
 	case "playing":
-		// Update bombs
-		updateBombs(room, now)
-		
-		// Check for game end condition
-		alivePlayers := 0
-		for _, player := range room.Players {
-			if player.Lives > 0 {
-				alivePlayers++
-			}
-		}
-		
-		if alivePlayers <= 1 {
-			room.State = "finished"
-			
-			// Find winner
-			var winner *Player
-			for _, player := range room.Players {
-				if player.Lives > 0 {
-					winner = player
-					break
-				}
-			}
-			
-			// Notify outside of lock
-			winnerData := map[string]interface{}{
-				"state": "finished",
-			}
-			if winner != nil {
-				winnerData["winner"] = winner
-			}
-			
-			go broadcastToRoom(room, Message{
-				Type: "gameEnded",
-				Data: winnerData,
-			}, "")
-		}
-	}
-}
-
-// Update bombs in room
-func updateBombs(room *GameRoom, now time.Time) {
-	for bombID, bomb := range room.Bombs {
-		// Check if bomb should explode
-		if now.Sub(bomb.Created) >= 3*time.Second {
-			explodeBomb(room, bomb, now)
-			delete(room.Bombs, bombID)
-		}
-	}
-}
-
-// Handle bomb explosion
-func explodeBomb(room *GameRoom, bomb *Bomb, now time.Time) {
-	// Get explosion range
-	explosionRange := 2 // Base range
-	if player, exists := room.Players[bomb.PlayerID]; exists {
-		explosionRange += player.PowerUps.Flames
-	}
-
-	// Calculate explosion positions
-	explosions := [][]int{{bomb.X, bomb.Y}} // Center
-
-	// Add explosion in 4 directions
-	directions := [][]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}} // up, down, left, right
-	for _, dir := range directions {
-		for i := 1; i <= explosionRange; i++ {
-			x := bomb.X + dir[0]*i
-			y := bomb.Y + dir[1]*i
-
-			// Check bounds
-			if x < 0 || x >= MAP_WIDTH || y < 0 || y >= MAP_HEIGHT {
+		// Run the fixed-length ticks that are due, each applying the
+		// buffered inputs and the bots' moves
+		step := tickDuration()
+		events := []sim.Event{}
+		for ticks := 0; now.Sub(room.LastTick) >= step && !room.Sim.Over(); ticks++ {
+			// Drop the lag after a long stall instead of fast-forwarding through it
+			if ticks == MAX_CATCH_UP_TICKS {
+				room.LastTick = now
 				break
 			}
 
-			// Check for walls
-			if room.Map[y][x] == 1 {
-				break // Solid wall stops explosion
-			}
-
-			explosions = append(explosions, []int{x, y})
-
-			// Destroy destructible blocks
-			if room.Map[y][x] == 2 {
-				room.Map[y][x] = 0
-				// Maybe spawn power-up here
-				break // Destructible block stops explosion
-			}
+			inputs := append(takeInputs(room), botInputs(room)...)
+			_, stepEvents := sim.Step(room.Sim, inputs, step)
+			room.LastTick = room.LastTick.Add(step)
+			events = append(events, stepEvents...)
 		}
-	}
+		room.Sync.record(events)
+		broadcastEvents(room, events)
+		ackInputs(room)
 
-	// Check for player damage
-	for _, player := range room.Players {
-		if player.Lives <= 0 {
-			continue
-		}
-
-		for _, explosion := range explosions {
-			if player.X == explosion[0] && player.Y == explosion[1] {
-				player.Lives--
-				log.Printf("Player %s hit by explosion, lives remaining: %d", player.ID, player.Lives)
-				break
-			}
+		// Check for game end condition
+		if room.Sim.Over() {
+			endGame(room)
 		}
 	}
 
-	// Broadcast explosion
-	go broadcastToRoom(room, Message{
-		Type: "bombExploded",
-		Data: map[string]interface{}{
-			"bombId":     bomb.ID,
-			"explosions": explosions,
-			"map":        room.Map,
-			"players":    room.Players,
-		},
-	}, "")
+	relieveSlowClients(room, now)
+	flushSync(room, now)
 }
 
-// Clean up inactive rooms and players
-func cleanupInactiveRooms() {
-	roomsMutex.Lock()
-	defer roomsMutex.Unlock()
-
-	now := time.Now()
-	roomsToDelete := []string{}
-
-	for roomID, room := range gameRooms {
-		room.mutex.Lock()
-		
-		// Remove inactive players
-		playersToRemove := []string{}
-		for playerID, player := range room.Players {
-			if now.Sub(player.LastSeen) > PLAYER_TIMEOUT {
-				playersToRemove = append(playersToRemove, playerID)
-			}
-		}
-		
-		for _, playerID := range playersToRemove {
-			delete(room.Players, playerID)
-			delete(room.Clients, playerID)
-		}
-		
-		// Mark empty rooms for deletion
-		if len(room.Players) == 0 {
-			roomsToDelete = append(roomsToDelete, roomID)
-		}
-		
-		room.mutex.Unlock()
-	}
-
-	// Delete empty rooms
-	for _, roomID := range roomsToDelete {
-		delete(gameRooms, roomID)
-		log.Printf("Cleaned up empty room: %s", roomID)
+// Player IDs in a stable order, so simultaneous events resolve the same way every time
+func sortedPlayerIDs(room *GameRoom) []string {
+	playerIDs := make([]string, 0, len(room.Players))
+	for playerID := range room.Players {
+		playerIDs = append(playerIDs, playerID)
 	}
-}
\ No newline at end of file
+	sort.Strings(playerIDs)
+	return playerIDs
+}
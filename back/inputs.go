@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"bomberman-multiplayer/sim"
+)
+
+// Input buffering limits
+const (
+	INPUT_BUFFER_SIZE   = 32 // Inputs a player can have waiting for the next tick
+	MAX_INPUTS_PER_TICK = 4  // Inputs applied per player and tick, the rest wait
+	MAX_CATCH_UP_TICKS  = 5  // Ticks run at once after a stall before the lag is dropped
+)
+
+// Length of one simulation tick
+func tickDuration() time.Duration {
+	return time.Second / time.Duration(config.TickRate)
+}
+
+// Queue a player's input for the next tick. Sequence numbers must go up, so
+// a retransmitted input is only applied once. Must run on the room goroutine.
+func bufferInput(room *GameRoom, playerID string, input PlayerInput) *ErrorData {
+	player, exists := room.Players[playerID]
+	if !exists {
+		return nil
+	}
+
+	last := player.LastInputSeq
+	if n := len(player.Inputs); n > 0 {
+		last = player.Inputs[n-1].SequenceNumber
+	}
+	if input.SequenceNumber <= last {
+		return &ErrorData{
+			Code:    ERR_INVALID_DATA,
+			Message: fmt.Sprintf("sequenceNumber %d is not after %d", input.SequenceNumber, last),
+			Type:    "playerInput",
+		}
+	}
+
+	if len(player.Inputs) >= INPUT_BUFFER_SIZE {
+		return &ErrorData{
+			Code:    ERR_RATE_LIMITED,
+			Message: fmt.Sprintf("more than %d inputs waiting for the next tick", INPUT_BUFFER_SIZE),
+			Type:    "playerInput",
+		}
+	}
+
+	player.Inputs = append(player.Inputs, input)
+	return nil
+}
+
+// Take the inputs to apply this tick, players in a stable order and each
+// player's in the order they were sent. Must run on the room goroutine.
+func takeInputs(room *GameRoom) []sim.Input {
+	inputs := []sim.Input{}
+	for _, playerID := range sortedPlayerIDs(room) {
+		player := room.Players[playerID]
+		count := min(len(player.Inputs), MAX_INPUTS_PER_TICK)
+
+		for _, buffered := range player.Inputs[:count] {
+			input := sim.Input{
+				PlayerID:  playerID,
+				Type:      buffered.Type,
+				Direction: buffered.Direction,
+			}
+			room.Recorder.RecordInput(input, room.Sim.Tick)
+			inputs = append(inputs, input)
+			player.LastInputSeq = buffered.SequenceNumber
+		}
+		player.Inputs = player.Inputs[count:]
+	}
+	return inputs
+}
+
+// Tell each player which of their inputs the last tick applied, with where
+// they ended up, so the client can replay the ones still in flight on top.
+// Must run on the room goroutine.
+func ackInputs(room *GameRoom) {
+	for playerID, player := range room.Players {
+		client, connected := room.Clients[playerID]
+		if !connected || player.LastInputSeq == player.AckedInputSeq {
+			continue
+		}
+
+		player.AckedInputSeq = player.LastInputSeq
+		client.sendMessage(Message{Type: "inputAck", Data: InputAckData{
+			Seq:  player.LastInputSeq,
+			Tick: room.Sim.Tick,
+			X:    player.X,
+			Y:    player.Y,
+		}})
+	}
+}
+
+// Forget a player's input numbering, for a new connection that starts its
+// own. Must run on the room goroutine.
+func resetInputs(player *Player) {
+	player.Inputs = nil
+	player.LastInputSeq = 0
+	player.AckedInputSeq = 0
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Limites de pagination du classement (sans limit, GET /score renvoie tout)
+const (
+	MAX_SCORE_LIMIT   = 100
+	DEFAULT_TOP_LIMIT = 10
+)
+
+// Format des dates stockées (identique à CURRENT_TIMESTAMP de SQLite)
+const scoreDateLayout = "2006-01-02 15:04:05"
+
+// Filtres, tri et pagination d'une requête sur les scores
+type ScoreQuery struct {
+	SortBy    string // "score" ou "time"
+	Order     string // "asc" ou "desc"
+	Limit     int    // 0 : pas de limite
+	Offset    int
+	Name      string // Recherche partielle, insensible à la casse
+	ExactName string // Nom exact, pour l'historique d'un joueur
+	From      time.Time
+	To        time.Time
+}
+
+// Lire les paramètres de requête de GET /score
+func parseScoreQuery(r *http.Request) (ScoreQuery, error) {
+	values := r.URL.Query()
+	query := ScoreQuery{
+		SortBy: "score",
+		Name:   strings.TrimSpace(values.Get("name")),
+	}
+
+	if sortBy := values.Get("sort"); sortBy != "" {
+		if sortBy != "score" && sortBy != "time" {
+			return query, fmt.Errorf("sort must be score or time")
+		}
+		query.SortBy = sortBy
+	}
+
+	// Par défaut : meilleurs scores d'abord, temps les plus courts d'abord
+	query.Order = "desc"
+	if query.SortBy == "time" {
+		query.Order = "asc"
+	}
+	if order := values.Get("order"); order != "" {
+		if order != "asc" && order != "desc" {
+			return query, fmt.Errorf("order must be asc or desc")
+		}
+		query.Order = order
+	}
+
+	var err error
+	if query.Limit, err = parseIntParam(values.Get("limit"), 0, 1, MAX_SCORE_LIMIT); err != nil {
+		return query, fmt.Errorf("limit: %w", err)
+	}
+	if query.Offset, err = parseIntParam(values.Get("offset"), 0, 0, -1); err != nil {
+		return query, fmt.Errorf("offset: %w", err)
+	}
+	if query.From, err = parseDateParam(values.Get("from"), false); err != nil {
+		return query, fmt.Errorf("from: %w", err)
+	}
+	if query.To, err = parseDateParam(values.Get("to"), true); err != nil {
+		return query, fmt.Errorf("to: %w", err)
+	}
+
+	return query, nil
+}
+
+// Lire un entier borné (max < 0 : pas de borne haute)
+func parseIntParam(raw string, fallback, min, max int) (int, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("must be an integer")
+	}
+	if value < min || (max >= 0 && value > max) {
+		if max >= 0 {
+			return 0, fmt.Errorf("must be between %d and %d", min, max)
+		}
+		return 0, fmt.Errorf("must be at least %d", min)
+	}
+	return value, nil
+}
+
+// Lire une date au format RFC 3339 ou AAAA-MM-JJ. Une date seule
+// utilisée comme borne haute couvre toute la journée.
+func parseDateParam(raw string, endOfDay bool) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("must be a date (YYYY-MM-DD or RFC 3339)")
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
+
+// Convertir le champ Time ("m:ss", "h:mm:ss", "1m30s" ou des millisecondes) en durée
+func parseScoreTime(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, fmt.Errorf("empty time")
+	}
+
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		if ms < 0 {
+			return 0, fmt.Errorf("negative time")
+		}
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+
+	if strings.Contains(raw, ":") {
+		parts := strings.Split(raw, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("invalid time %q", raw)
+		}
+		var total time.Duration
+		for i, part := range parts {
+			value, err := strconv.Atoi(part)
+			if err != nil || value < 0 || (i > 0 && value >= 60) {
+				return 0, fmt.Errorf("invalid time %q", raw)
+			}
+			total = total*60 + time.Duration(value)
+		}
+		return total * time.Second, nil
+	}
+
+	duration, err := time.ParseDuration(raw)
+	if err != nil || duration < 0 {
+		return 0, fmt.Errorf("invalid time %q", raw)
+	}
+	return duration, nil
+}
+
+// Durée d'un score en millisecondes, 0 si le champ Time est illisible
+func scoreTimeMs(raw string) int64 {
+	duration, err := parseScoreTime(raw)
+	if err != nil {
+		return 0
+	}
+	return duration.Milliseconds()
+}
+
+// Filtrer, trier et paginer une liste de scores en mémoire.
+// Renvoie la page demandée et le nombre total de résultats.
+func applyScoreQuery(scores []scoreToSend, query ScoreQuery) ([]scoreToSend, int) {
+	filtered := []scoreToSend{}
+	name := strings.ToLower(query.Name)
+	for _, entry := range scores {
+		if query.ExactName != "" && entry.Name != query.ExactName {
+			continue
+		}
+		if name != "" && !strings.Contains(strings.ToLower(entry.Name), name) {
+			continue
+		}
+		if !query.From.IsZero() && entry.Date.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && entry.Date.After(query.To) {
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, b := filtered[i], filtered[j]
+		if query.SortBy == "time" && a.DurationMs != b.DurationMs {
+			if query.Order == "asc" {
+				return a.DurationMs < b.DurationMs
+			}
+			return a.DurationMs > b.DurationMs
+		}
+		if a.Score != b.Score {
+			if query.Order == "asc" && query.SortBy == "score" {
+				return a.Score < b.Score
+			}
+			return a.Score > b.Score
+		}
+		return a.Date.Before(b.Date)
+	})
+
+	total := len(filtered)
+	if query.Offset >= total {
+		return []scoreToSend{}, total
+	}
+	end := total
+	if query.Limit > 0 && query.Offset+query.Limit < end {
+		end = query.Offset + query.Limit
+	}
+	return filtered[query.Offset:end], total
+}
+
+// GET /score/top : les N meilleurs scores
+func getTopScores(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit, err := parseIntParam(r.URL.Query().Get("limit"), DEFAULT_TOP_LIMIT, 1, MAX_SCORE_LIMIT)
+	if err != nil {
+		http.Error(w, "limit: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scores, _, err := scoreStore.Query(ScoreQuery{SortBy: "score", Order: "desc", Limit: limit})
+	if err != nil {
+		http.Error(w, "Unable to load scores", http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(scores); err != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// GET /score/{name} : meilleur score et historique d'un joueur
+func getPlayerScores(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	name := mux.Vars(r)["name"]
+
+	history, total, err := scoreStore.Query(ScoreQuery{ExactName: name, SortBy: "score", Order: "desc"})
+	if err != nil {
+		http.Error(w, "Unable to load scores", http.StatusInternalServerError)
+		return
+	}
+	if total == 0 {
+		http.Error(w, "No scores for this player", http.StatusNotFound)
+		return
+	}
+	best := history[0]
+
+	// Historique du plus récent au plus ancien
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Date.After(history[j].Date)
+	})
+
+	response := map[string]interface{}{
+		"name":    name,
+		"best":    best,
+		"games":   total,
+		"history": history,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
@@ -1,22 +1,34 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+
+	"bomberman-multiplayer/bot"
+	"bomberman-multiplayer/sim"
 )
 
 // Structure des données pour les scores
 type scoreToSend struct {
-	Name  string `json:"name"`
-	Score int    `json:"score"`
-	Time  string `json:"time"` // Temps en millisecondes
+	Name       string    `json:"name"`
+	Score      int       `json:"score"`
+	Time       string    `json:"time"`                // Durée de la partie ("m:ss")
+	DurationMs int64     `json:"durationMs"`          // Time converti en millisecondes, pour le tri
+	Mode       string    `json:"mode,omitempty"`      // "solo" ou "multiplayer"
+	Placement  int       `json:"placement,omitempty"` // Classement en multijoueur
+	Date       time.Time `json:"date"`
 }
 
 type scoreToGet struct {
@@ -27,57 +39,75 @@ type scoreToGet struct {
 
 // Structures pour le multijoueur
 type Player struct {
-	ID       string    `json:"id"`
-	Name     string    `json:"name"`
-	X        int       `json:"x"`
-	Y        int       `json:"y"`
-	Lives    int       `json:"lives"`
-	Score    int       `json:"score"`
-	PowerUps PowerUps  `json:"powerUps"`
-	LastSeen time.Time `json:"-"`
+	*sim.Player
+	LastSeen       time.Time     `json:"-"`
+	SessionToken   string        `json:"-"` // Lets the client resume after a dropped connection
+	Disconnected   bool          `json:"disconnected"`
+	DisconnectedAt time.Time     `json:"-"`
+	Inputs         []PlayerInput `json:"-"` // Waiting for the next tick
+	LastInputSeq   int           `json:"-"` // Sequence number of the last input applied
+	AckedInputSeq  int           `json:"-"` // Last sequence number sent in an inputAck
 }
 
-type PowerUps struct {
-	Bombs  int `json:"bombs"`
-	Flames int `json:"flames"`
-	Speed  int `json:"speed"`
-}
-
-type Bomb struct {
-	ID       string    `json:"id"`
-	X        int       `json:"x"`
-	Y        int       `json:"y"`
-	PlayerID string    `json:"playerId"`
-	Timer    int       `json:"timer"`
-	Created  time.Time `json:"-"`
+type GameRoom struct {
+	ID             string              `json:"id"`
+	Players        map[string]*Player  `json:"players"`
+	Sim            *sim.State          `json:"-"`     // Map, bombs and power-ups live in the simulation
+	State          string              `json:"state"` // "waiting", "countdown", "playing", "finished"
+	MaxPlayers     int                 `json:"maxPlayers"`
+	Rules          RoomRules           `json:"rules"`
+	StartTime      time.Time           `json:"-"`
+	CountdownStart time.Time           `json:"-"`
+	LastTick       time.Time           `json:"-"`
+	Clients        map[string]*Client  `json:"-"`
+	Spectators     map[string]*Client  `json:"-"`
+	Bots           map[string]*bot.Bot `json:"-"` // Players driven by the server
+	Recorder       *ReplayRecorder     `json:"-"`
+	Sync           *StateSync          `json:"-"`
+
+	inbox   chan func()   // Work for the room goroutine
+	done    chan struct{} // Closed once the room goroutine returned
+	stopped bool          // Set on the room goroutine to make it return
+
+	lastPlayerID int // Number in the last player ID handed out
 }
 
-type GameRoom struct {
-	ID          string             `json:"id"`
-	Players     map[string]*Player `json:"players"`
-	Bombs       map[string]*Bomb   `json:"bombs"`
-	Map         [][]int            `json:"map"`
-	State       string             `json:"state"` // "waiting", "countdown", "playing", "finished"
-	MaxPlayers  int                `json:"maxPlayers"`
-	StartTime   time.Time          `json:"-"`
-	CountdownStart time.Time       `json:"-"`
-	Clients     map[string]*Client `json:"-"`
-	mutex       sync.RWMutex       `json:"-"`
+// The room as sent to clients. Must run on the room goroutine.
+func (room *GameRoom) Snapshot() RoomSnapshot {
+	return RoomSnapshot{
+		ID:         room.ID,
+		Players:    room.Players,
+		Bombs:      room.Sim.Bombs,
+		PowerUps:   room.Sim.PowerUps,
+		Map:        room.Sim.Map,
+		State:      room.State,
+		MaxPlayers: room.MaxPlayers,
+		Rules:      room.Rules,
+	}
 }
 
 type Client struct {
-	Conn     *websocket.Conn
-	PlayerID string
-	RoomID   string
-	Send     chan []byte
+	Conn      *websocket.Conn
+	PlayerID  string // Spectator ID for spectators
+	RoomID    string
+	Send      chan outgoing // Filled and closed by the room goroutine, see readPump
+	Spectator bool
+	Delta     bool // Game state comes as sync frames instead of events
+	Binary    bool // Sync frames are binary-encoded
+
+	// Owned by the room goroutine
+	needKeyframe bool
+	lagging      bool // Send is past its high-water mark, see backpressure.go
+	lagSince     time.Time
+	backlog      []outgoing // Messages waiting for room in Send while lagging
+	stale        bool       // State updates were skipped, resync on catching up
+	evicted      bool
 }
 
-type Message struct {
-	Type    string      `json:"type"`
-	Data    interface{} `json:"data,omitempty"`
-	From    string      `json:"from,omitempty"`
-	To      string      `json:"to,omitempty"`
-	RoomID  string      `json:"roomId,omitempty"`
+// A message queued for writePump
+type outgoing struct {
+	data   []byte
+	binary bool
 }
 
 type ChatMessage struct {
@@ -87,21 +117,18 @@ type ChatMessage struct {
 	Timestamp   time.Time `json:"timestamp"`
 }
 
-type PlayerInput struct {
-	Type      string `json:"type"` // "move", "bomb", "pause"
-	Direction string `json:"direction,omitempty"` // "up", "down", "left", "right"
-	X         int    `json:"x,omitempty"`
-	Y         int    `json:"y,omitempty"`
-}
+// Fichiers de sauvegarde des scores par défaut
+const (
+	SCORES_FILE    = "./json_directory/scores.json"
+	SCORES_DB_FILE = "./json_directory/scores.db"
+)
 
 var (
-	score []scoreToSend
+	scoreStore ScoreStore
 	gameRooms = make(map[string]*GameRoom)
 	roomsMutex sync.RWMutex
 	upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all origins for development
-		},
+		CheckOrigin: checkOrigin, // Every origin unless allowed-origins is set
 	}
 )
 
@@ -111,6 +138,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count")
 
 		// Si la méthode est OPTIONS, on répond directement
 		if r.Method == "OPTIONS" {
@@ -126,7 +154,21 @@ func corsMiddleware(next http.Handler) http.Handler {
 func sendScore(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	err := json.NewEncoder(w).Encode(score)
+	// Lire le tri, les filtres et la pagination
+	query, err := parseScoreQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scores, total, err := scoreStore.Query(query)
+	if err != nil {
+		http.Error(w, "Unable to load scores", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	err = json.NewEncoder(w).Encode(scores)
 	if err != nil {
 		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
 	}
@@ -137,86 +179,130 @@ func getScore(w http.ResponseWriter, r *http.Request) {
 	var newScore scoreToGet
 
 	// Décoder le score envoyé dans la requête POST
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_SCORE_BODY)
 	err := json.NewDecoder(r.Body).Decode(&newScore)
 	if err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, "Invalid JSON body", nil)
 		return
 	}
 
-	// Ajouter le score à la liste existante
-	newEntry := scoreToSend{
-		Name:  newScore.Name,
-		Score: newScore.Score,
-		Time:  newScore.Time,
+	// Vérifier le nom, le score et le temps
+	newEntry, fields := validateScore(newScore)
+	if fields != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid score", fields)
+		return
 	}
-	score = append(score, newEntry)
 
-	// Sauvegarder dans le fichier JSON
-	saveScoresToFile("./json_directory/scores.json")
-}
+	// Les scores envoyés par un client sont toujours des parties solo :
+	// seuls les salons multijoueurs du serveur enregistrent un classement
+	newEntry.Mode = "solo"
+	newEntry = normalizeScore(newEntry)
 
-func saveScoresToFile(filename string) {
-	// Ouvrir le fichier en écriture (création ou remplacement)
-	file, err := os.Create(filename)
-	if err != nil {
-		fmt.Println("Error creating file:", err)
+	if err := scoreStore.Add(newEntry); err != nil {
+		fmt.Println("Error saving scores:", err)
+		writeJSONError(w, http.StatusInternalServerError, "Unable to save score", nil)
 		return
 	}
-	defer file.Close()
 
-	// Encoder et écrire les scores
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(score)
+	rank, err := scoreStore.Rank(newEntry.Score)
 	if err != nil {
-		fmt.Println("Error encoding data to file:", err)
+		fmt.Println("Error computing rank:", err)
 	}
-}
-
-func loadScoresFromFile(filename string) []scoreToSend {
-	var existingScores []scoreToSend
 
-	// Ouvrir le fichier s'il existe
-	file, err := os.Open(filename)
-	if err != nil {
-		// Si le fichier n'existe pas, retourner une liste vide
-		fmt.Println("No existing scores found, starting fresh.")
-		return existingScores
-	}
-	defer file.Close()
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"score": newEntry,
+		"rank":  rank,
+	})
+}
 
-	// Décoder les scores depuis le fichier
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&existingScores)
-	if err != nil {
-		fmt.Println("Error decoding scores from file:", err)
+// Ajouter des scores au stockage
+func recordScores(entries ...scoreToSend) {
+	if err := scoreStore.Add(entries...); err != nil {
+		fmt.Println("Error saving scores:", err)
 	}
-
-	return existingScores
 }
 
-func main() {
-	// Charger les scores existants dans la variable globale "score"
-	score = loadScoresFromFile("./json_directory/scores.json")
-
+// Routes HTTP et WebSocket du serveur
+func newRouter() http.Handler {
 	// INITIALISE LE ROUTEUR
 	r := mux.NewRouter()
 
 	// ROUTES ET ENDPOINTS
 	r.HandleFunc("/score", sendScore).Methods("GET")
+	r.HandleFunc("/score/top", getTopScores).Methods("GET")
+	r.HandleFunc("/score/{name}", getPlayerScores).Methods("GET")
 	r.HandleFunc("/score", getScore).Methods("POST")
 	r.HandleFunc("/ws", handleWebSocket).Methods("GET")
+	r.HandleFunc("/protocol", getProtocolSchema).Methods("GET")
 	r.HandleFunc("/rooms", getRooms).Methods("GET")
 	r.HandleFunc("/rooms", createRoom).Methods("POST")
+	r.HandleFunc("/rooms/{id}/bots", addBots).Methods("POST")
+	r.HandleFunc("/replays", getReplays).Methods("GET")
+	r.HandleFunc("/replays/{id}", getReplay).Methods("GET")
 
 	// Ajouter le middleware CORS
-	http.Handle("/", corsMiddleware(r))
+	return corsMiddleware(r)
+}
 
-	// Start game loop for all rooms
-	go gameTickLoop()
+func main() {
+	// "schema" écrit le schéma JSON du protocole WebSocket et quitte
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		if err := writeProtocolSchema(os.Stdout); err != nil {
+			fmt.Println("Error writing schema:", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	port := ":8080"
-	fmt.Println("Bomberman multiplayer server running on port", port)
-	if err := http.ListenAndServe(port, nil); err != nil {
+	// Charger la configuration (fichier, environnement, options)
+	cfg, err := loadConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Println("Error loading config:", err)
+		os.Exit(1)
+	}
+	config = cfg
+	config.Print()
+
+	// Ouvrir le stockage des scores
+	store, err := openScoreStore(config.Store, config.ScoresFile, config.ScoresDBFile)
+	if err != nil {
+		fmt.Println("Error opening score store:", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	scoreStore = store
+
+	http.Handle("/", newRouter())
+
+	server := &http.Server{Addr: config.Addr}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	fmt.Println("Bomberman multiplayer server listening on", config.Addr)
+
+	// Attendre SIGINT/SIGTERM (ou une erreur du serveur)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
 		fmt.Println("Error starting server:", err)
+		return
+	case sig := <-signals:
+		fmt.Printf("Received %s, shutting down (send it again to stop now)\n", sig)
+	}
+
+	// Laisser les parties en cours se terminer, puis tout arrêter
+	shutdownRooms(signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Println("Error stopping server:", err)
 	}
+	fmt.Println("Server stopped")
 }
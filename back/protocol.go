@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"bomberman-multiplayer/sim"
+)
+
+//go:generate sh -c "go run . schema > protocol.schema.json"
+
+// Version of the WebSocket protocol. Clients announce the version they speak
+// with the protocol query parameter and the server echoes its own in welcome.
+// Bump it on any incompatible change to the messages below.
+const PROTOCOL_VERSION = 2
+
+const MAX_CHAT_LENGTH = 200
+
+// Codes sent in error messages
+const (
+	ERR_UNSUPPORTED_PROTOCOL = "unsupported_protocol"
+	ERR_UNSUPPORTED_SYNC     = "unsupported_sync"
+	ERR_NAME_REQUIRED        = "name_required"
+	ERR_SHUTTING_DOWN        = "shutting_down"
+	ERR_ROOM_FULL            = "room_full"
+	ERR_ROOM_NOT_FOUND       = "room_not_found"
+	ERR_JOIN_FAILED          = "join_failed"
+	ERR_REPLAY_NOT_FOUND     = "replay_not_found"
+	ERR_INVALID_REPLAY       = "invalid_replay"
+	ERR_MALFORMED_MESSAGE    = "malformed_message"    // Not a JSON message envelope
+	ERR_UNKNOWN_MESSAGE      = "unknown_message_type" // Envelope with a type the server does not handle
+	ERR_INVALID_DATA         = "invalid_data"         // Known type with a bad payload
+	ERR_FORBIDDEN            = "forbidden"            // Valid message the client may not send
+	ERR_RATE_LIMITED         = "rate_limited"         // Too many messages waiting to be handled
+)
+
+// Envelope of every message the server sends. Data holds the payload type
+// registered for Type in serverMessages.
+type Message struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+	From string      `json:"from,omitempty"` // Player who caused the message
+}
+
+// Envelope of every message a client sends, before its data is decoded
+type ClientMessage struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Client payloads
+
+type ChatInput struct {
+	Message string `json:"message"`
+}
+
+type PlayerInput struct {
+	Type           string `json:"type" enum:"move,bomb"`
+	Direction      string `json:"direction,omitempty" enum:"up,down,left,right"`
+	X              int    `json:"x,omitempty"`         // Client position, ignored by the server
+	Y              int    `json:"y,omitempty"`         // Client position, ignored by the server
+	Timestamp      int64  `json:"timestamp,omitempty"` // Client clock in ms
+	SequenceNumber int    `json:"sequenceNumber"`      // Increases with every input, acknowledged in inputAck
+}
+
+// Server payloads
+
+type ErrorData struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"` // Type of the message that was refused
+}
+
+// Sent once on connection. Players get a session token to resume with;
+// spectators get a spectator ID instead.
+type WelcomeData struct {
+	ProtocolVersion  int          `json:"protocolVersion"`
+	RoomID           string       `json:"roomId"`
+	Room             RoomSnapshot `json:"room"`
+	PlayerID         string       `json:"playerId,omitempty"`
+	SessionToken     string       `json:"sessionToken,omitempty"`
+	ReconnectGraceMs int64        `json:"reconnectGraceMs,omitempty"`
+	Resumed          bool         `json:"resumed,omitempty"`
+	SpectatorID      string       `json:"spectatorId,omitempty"`
+	Spectator        bool         `json:"spectator,omitempty"`
+	TickRate         int          `json:"tickRate"` // Simulation ticks per second
+	Sync             string       `json:"sync" enum:"events,delta"`
+	Encoding         string       `json:"encoding" enum:"json,binary"` // Of sync frames
+}
+
+// The room as sent to clients, with the simulation's map, bombs and power-ups inlined
+type RoomSnapshot struct {
+	ID         string                  `json:"id"`
+	Players    map[string]*Player      `json:"players"`
+	Bombs      map[string]*sim.Bomb    `json:"bombs"`
+	PowerUps   map[string]*sim.PowerUp `json:"powerUps"`
+	Map        [][]int                 `json:"map"`
+	State      string                  `json:"state"`
+	MaxPlayers int                     `json:"maxPlayers"`
+	Rules      RoomRules               `json:"rules"`
+}
+
+// Full match state, sent on join and recorded at the start of replays
+type GameStateData struct {
+	Players    map[string]*Player      `json:"players"`
+	Bombs      map[string]*sim.Bomb    `json:"bombs"`
+	PowerUps   map[string]*sim.PowerUp `json:"powerUps"`
+	Map        [][]int                 `json:"map"`
+	Explosions []sim.ActiveFire        `json:"explosions"`
+	State      string                  `json:"state"`
+	Tick       uint64                  `json:"tick"`
+}
+
+type PlayerRef struct {
+	PlayerID string `json:"playerId"`
+}
+
+type PlayerDisconnectedData struct {
+	PlayerID string `json:"playerId"`
+	GraceMs  int64  `json:"graceMs"` // Time left to reconnect
+}
+
+// Countdown start carries its duration, later updates the time remaining
+type CountdownData struct {
+	Duration      int   `json:"duration,omitempty"`
+	TimeRemaining int64 `json:"timeRemaining,omitempty"`
+}
+
+type WaitTimerData struct {
+	TimeRemaining int64 `json:"timeRemaining"`
+}
+
+type GameStartedData struct {
+	State string `json:"state"`
+}
+
+type GameEndedData struct {
+	State   string             `json:"state"`
+	Results []sim.PlayerResult `json:"results"`
+	Winner  *Player            `json:"winner,omitempty"` // Missing on a draw
+}
+
+type ServerShutdownData struct {
+	Deadline    time.Time `json:"deadline"`
+	RemainingMs int64     `json:"remainingMs"`
+}
+
+// The last input the server applied for this client, and the position it
+// led to at the end of that tick
+type InputAckData struct {
+	Seq  int    `json:"seq"`
+	Tick uint64 `json:"tick"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+}
+
+// Sent when a client falls behind: state updates are skipped until it
+// catches up, and it is disconnected if it has not within EvictAfterMs
+type LagWarningData struct {
+	QueuedMessages int   `json:"queuedMessages"`
+	EvictAfterMs   int64 `json:"evictAfterMs"`
+}
+
+type ReplayStartedData struct {
+	Replay ReplayMeta `json:"replay"`
+	Speed  float64    `json:"speed"`
+}
+
+type ReplayEndedData struct {
+	ReplayID string `json:"replayId"`
+}
+
+// Payload type of each client message. A nil entry takes no data.
+var clientMessages = map[string]interface{}{
+	"chat":        ChatInput{},
+	"playerInput": PlayerInput{},
+	"ping":        nil,
+	"resync":      nil, // Ask for the full state after missing a frame
+}
+
+// Payload type of each server message. A nil entry carries no data.
+var serverMessages = map[string]interface{}{
+	"welcome":            WelcomeData{},
+	"gameState":          GameStateData{},
+	"error":              ErrorData{},
+	"pong":               nil,
+	"inputAck":           InputAckData{},
+	"lagWarning":         LagWarningData{},
+	"chat":               ChatMessage{},
+	"playerJoined":       Player{},
+	"playerLeft":         PlayerRef{},
+	"playerReconnected":  PlayerRef{},
+	"playerDisconnected": PlayerDisconnectedData{},
+	"waitTimer":          WaitTimerData{},
+	"countdown":          CountdownData{},
+	"gameStarted":        GameStartedData{},
+	"gameEnded":          GameEndedData{},
+	"serverShutdown":     ServerShutdownData{},
+	"replayStarted":      ReplayStartedData{},
+	"replayEnded":        ReplayEndedData{},
+	"stateDelta":         SyncFrame{},
+	"keyframe":           SyncFrame{},
+
+	// Simulation events
+	"playerMoved":      sim.PlayerMoved{},
+	"powerUpCollected": sim.PowerUpCollected{},
+	"bombPlaced":       sim.Bomb{},
+	"bombMoved":        sim.BombMoved{},
+	"bombExploded":     sim.BombExploded{},
+	"powerUpSpawned":   sim.PowerUp{},
+	"powerUpDestroyed": sim.PowerUpDestroyed{},
+	"playerHit":        sim.BombHit{},
+}
+
+// Log a message whose data does not match its registered payload, so a
+// server change that forgets the protocol types shows up straight away
+func checkServerMessage(msg Message) {
+	payload, known := serverMessages[msg.Type]
+	if !known {
+		log.Printf("Protocol: unregistered message type %q", msg.Type)
+		return
+	}
+
+	want, got := reflect.TypeOf(payload), reflect.TypeOf(msg.Data)
+	if got != nil && got.Kind() == reflect.Ptr {
+		got = got.Elem()
+	}
+	if want != got {
+		log.Printf("Protocol: %s sent with %v data, expected %v", msg.Type, got, want)
+	}
+}
+
+func errorMessage(code, message string) Message {
+	return Message{Type: "error", Data: ErrorData{Code: code, Message: message}}
+}
+
+// Decode a client message into the payload registered for its type. The
+// returned error data is ready to send back when the message is refused.
+func decodeClientMessage(raw []byte) (string, interface{}, *ErrorData) {
+	var msg ClientMessage
+	if err := decodeStrict(raw, &msg); err != nil || msg.Type == "" {
+		return "", nil, &ErrorData{Code: ERR_MALFORMED_MESSAGE, Message: "expected a JSON object with a type"}
+	}
+
+	payload, known := clientMessages[msg.Type]
+	if !known {
+		return "", nil, &ErrorData{Code: ERR_UNKNOWN_MESSAGE, Message: fmt.Sprintf("unknown message type %q", msg.Type), Type: msg.Type}
+	}
+	if payload == nil {
+		return msg.Type, nil, nil
+	}
+
+	data := reflect.New(reflect.TypeOf(payload)).Interface()
+	if len(msg.Data) == 0 {
+		return "", nil, &ErrorData{Code: ERR_INVALID_DATA, Message: "data is required", Type: msg.Type}
+	}
+	if err := decodeStrict(msg.Data, data); err != nil {
+		return "", nil, &ErrorData{Code: ERR_INVALID_DATA, Message: err.Error(), Type: msg.Type}
+	}
+	if v, ok := data.(interface{ validate() error }); ok {
+		if err := v.validate(); err != nil {
+			return "", nil, &ErrorData{Code: ERR_INVALID_DATA, Message: err.Error(), Type: msg.Type}
+		}
+	}
+
+	return msg.Type, data, nil
+}
+
+// Unmarshal JSON, refusing fields the target type does not have
+func decodeStrict(raw []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+func (c *ChatInput) validate() error {
+	if c.Message == "" {
+		return fmt.Errorf("message is required")
+	}
+	if len(c.Message) > MAX_CHAT_LENGTH {
+		return fmt.Errorf("message must be at most %d bytes", MAX_CHAT_LENGTH)
+	}
+	return nil
+}
+
+func (p *PlayerInput) validate() error {
+	if p.SequenceNumber < 1 {
+		return fmt.Errorf("sequenceNumber must be positive")
+	}
+
+	switch p.Type {
+	case "move":
+		switch p.Direction {
+		case "up", "down", "left", "right":
+			return nil
+		}
+		return fmt.Errorf("direction must be up, down, left or right")
+	case "bomb":
+		return nil
+	}
+	return fmt.Errorf("type must be move or bomb")
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"bomberman-multiplayer/sim"
+)
+
+// Replay constants
+const (
+	REPLAYS_DIR       = "./json_directory/replays" // Default
+	MAX_REPLAY_EVENTS = 100000                     // Stop recording past this many entries
+	MIN_REPLAY_SPEED  = 0.25
+	MAX_REPLAY_SPEED  = 16.0
+)
+
+// Server events worth keeping in a replay (timers are left out)
+var replayedEvents = map[string]bool{
+	"playerJoined":       true,
+	"playerLeft":         true,
+	"playerDisconnected": true,
+	"playerReconnected":  true,
+	"playerMoved":        true,
+	"bombPlaced":         true,
+	"bombMoved":          true,
+	"bombExploded":       true,
+	"playerHit":          true,
+	"powerUpSpawned":     true,
+	"powerUpCollected":   true,
+	"powerUpDestroyed":   true,
+	"chat":               true,
+	"gameStarted":        true,
+	"gameEnded":          true,
+}
+
+var replayIDPattern = regexp.MustCompile(`^replay_[0-9]+$`)
+
+// One timestamped entry in a replay
+type ReplayEvent struct {
+	T       int64           `json:"t"` // Milliseconds since recording started
+	Kind    string          `json:"k"` // "event", "input" or "snapshot"
+	Message json.RawMessage `json:"m"`
+}
+
+// Summary of a stored replay, written next to the replay file
+type ReplayMeta struct {
+	ID         string             `json:"id"`
+	RoomID     string             `json:"roomId"`
+	StartedAt  time.Time          `json:"startedAt"`
+	DurationMs int64              `json:"durationMs"`
+	EventCount int                `json:"eventCount"`
+	Seed       int64              `json:"seed"` // Seed and rules, to replay the recorded inputs
+	Rules      RoomRules          `json:"rules"`
+	Results    []sim.PlayerResult `json:"results"`
+}
+
+// Full replay file contents
+type Replay struct {
+	ReplayMeta
+	Events []ReplayEvent `json:"events"`
+}
+
+// Collects everything a room broadcasts, with its own lock so a finished
+// match can be saved off the room goroutine
+type ReplayRecorder struct {
+	started time.Time
+	events  []ReplayEvent
+	mutex   sync.Mutex
+}
+
+func newReplayRecorder() *ReplayRecorder {
+	return &ReplayRecorder{started: time.Now()}
+}
+
+// Record an already marshaled message
+func (r *ReplayRecorder) record(kind string, data []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if len(r.events) >= MAX_REPLAY_EVENTS {
+		return
+	}
+	r.events = append(r.events, ReplayEvent{
+		T:       time.Since(r.started).Milliseconds(),
+		Kind:    kind,
+		Message: data,
+	})
+}
+
+// Record a broadcast if it is part of the match
+func (r *ReplayRecorder) RecordEvent(msgType string, data []byte) {
+	if replayedEvents[msgType] {
+		r.record("event", data)
+	}
+}
+
+// Record a player's input with the simulation tick it was applied on
+func (r *ReplayRecorder) RecordInput(input sim.Input, tick uint64) {
+	data, err := json.Marshal(map[string]interface{}{
+		"playerId": input.PlayerID,
+		"input":    input,
+		"tick":     tick,
+	})
+	if err == nil {
+		r.record("input", data)
+	}
+}
+
+// Record the full room state, so playback starts from the right map
+func (r *ReplayRecorder) RecordSnapshot(state GameStateData) {
+	data, err := json.Marshal(Message{Type: "gameState", Data: state})
+	if err == nil {
+		r.record("snapshot", data)
+	}
+}
+
+// Copy of the recorded events. They are in time order, since the room
+// goroutine records them all.
+func (r *ReplayRecorder) Events() []ReplayEvent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	events := make([]ReplayEvent, len(r.events))
+	copy(events, r.events)
+	return events
+}
+
+// Write a finished room's replay as gzip-compressed JSON plus a small metadata file
+func saveReplay(room *GameRoom, results []sim.PlayerResult) {
+	if room.Recorder == nil {
+		return
+	}
+
+	events := room.Recorder.Events()
+	replay := Replay{
+		ReplayMeta: ReplayMeta{
+			ID:         fmt.Sprintf("replay_%d", time.Now().UnixNano()),
+			RoomID:     room.ID,
+			StartedAt:  room.Recorder.started,
+			EventCount: len(events),
+			Seed:       room.Sim.Seed,
+			Rules:      room.Rules,
+			Results:    results,
+		},
+		Events: events,
+	}
+	if len(events) > 0 {
+		replay.DurationMs = events[len(events)-1].T
+	}
+
+	if err := os.MkdirAll(config.ReplaysDir, 0755); err != nil {
+		log.Printf("Error creating replays directory: %v", err)
+		return
+	}
+
+	if err := writeReplayFile(replay); err != nil {
+		log.Printf("Error saving replay for room %s: %v", room.ID, err)
+		return
+	}
+
+	log.Printf("Saved replay %s for room %s (%d events)", replay.ID, room.ID, len(events))
+}
+
+func writeReplayFile(replay Replay) error {
+	file, err := os.Create(filepath.Join(config.ReplaysDir, replay.ID+".json.gz"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zw := gzip.NewWriter(file)
+	if err := json.NewEncoder(zw).Encode(replay); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(replay.ReplayMeta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(config.ReplaysDir, replay.ID+".meta.json"), meta, 0644)
+}
+
+func loadReplay(id string) (*Replay, error) {
+	file, err := os.Open(replayPath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var replay Replay
+	if err := json.NewDecoder(zr).Decode(&replay); err != nil {
+		return nil, err
+	}
+	return &replay, nil
+}
+
+func replayPath(id string) string {
+	return filepath.Join(config.ReplaysDir, id+".json.gz")
+}
+
+// GET /replays : list stored replays, newest first
+func getReplays(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	files, err := filepath.Glob(filepath.Join(config.ReplaysDir, "*.meta.json"))
+	if err != nil {
+		http.Error(w, "Unable to list replays", http.StatusInternalServerError)
+		return
+	}
+
+	replays := make([]ReplayMeta, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var meta ReplayMeta
+		if err := json.Unmarshal(data, &meta); err != nil {
+			continue
+		}
+		replays = append(replays, meta)
+	}
+
+	sort.Slice(replays, func(i, j int) bool {
+		return replays[i].StartedAt.After(replays[j].StartedAt)
+	})
+
+	if err := json.NewEncoder(w).Encode(replays); err != nil {
+		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
+	}
+}
+
+// GET /replays/{id} : download a replay file
+func getReplay(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !replayIDPattern.MatchString(id) {
+		http.Error(w, "Invalid replay id", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := os.Stat(replayPath(id)); err != nil {
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", id+".json.gz"))
+	http.ServeFile(w, r, replayPath(id))
+}
+
+// Re-stream a replay's events over a WebSocket at the requested speed
+func streamReplay(conn *websocket.Conn, id, speedParam string) {
+	defer conn.Close()
+
+	speed := 1.0
+	if speedParam != "" {
+		parsed, err := strconv.ParseFloat(speedParam, 64)
+		if err != nil || parsed < MIN_REPLAY_SPEED || parsed > MAX_REPLAY_SPEED {
+			conn.WriteJSON(errorMessage(ERR_INVALID_REPLAY, fmt.Sprintf("speed must be between %g and %g", MIN_REPLAY_SPEED, MAX_REPLAY_SPEED)))
+			return
+		}
+		speed = parsed
+	}
+
+	if !replayIDPattern.MatchString(id) {
+		conn.WriteJSON(errorMessage(ERR_INVALID_REPLAY, "Invalid replay id"))
+		return
+	}
+	replay, err := loadReplay(id)
+	if err != nil {
+		conn.WriteJSON(errorMessage(ERR_REPLAY_NOT_FOUND, "Replay not found"))
+		return
+	}
+
+	// Stop streaming as soon as the viewer goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn.WriteJSON(Message{Type: "replayStarted", Data: ReplayStartedData{
+		Replay: replay.ReplayMeta,
+		Speed:  speed,
+	}})
+
+	var last int64
+	for _, event := range replay.Events {
+		if event.Kind == "input" {
+			continue
+		}
+
+		wait := time.Duration(float64(event.T-last)/speed) * time.Millisecond
+		last = event.T
+		select {
+		case <-closed:
+			return
+		case <-time.After(wait):
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, event.Message); err != nil {
+			return
+		}
+	}
+
+	conn.WriteJSON(Message{Type: "replayEnded", Data: ReplayEndedData{ReplayID: id}})
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "replay ended"))
+}
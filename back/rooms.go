@@ -9,43 +9,41 @@ import (
 
 // Room response structure for API
 type RoomResponse struct {
-	ID          string            `json:"id"`
-	PlayerCount int               `json:"playerCount"`
-	MaxPlayers  int               `json:"maxPlayers"`
-	State       string            `json:"state"`
-	Players     map[string]string `json:"players"` // ID -> Name mapping
-	CreatedAt   time.Time         `json:"createdAt"`
+	ID             string            `json:"id"`
+	PlayerCount    int               `json:"playerCount"`
+	SpectatorCount int               `json:"spectatorCount"`
+	MaxPlayers     int               `json:"maxPlayers"`
+	State          string            `json:"state"`
+	Players        map[string]string `json:"players"` // ID -> Name mapping
+	Rules          RoomRules         `json:"rules"`
+	CreatedAt      time.Time         `json:"createdAt"`
 }
 
 // Get list of available rooms
 func getRooms(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	roomsMutex.RLock()
-	rooms := make([]RoomResponse, 0, len(gameRooms))
-	
-	for _, room := range gameRooms {
-		room.mutex.RLock()
-		
-		// Create player name mapping
-		playerNames := make(map[string]string)
-		for playerID, player := range room.Players {
-			playerNames[playerID] = player.Name
-		}
-		
-		roomResponse := RoomResponse{
-			ID:          room.ID,
-			PlayerCount: len(room.Players),
-			MaxPlayers:  room.MaxPlayers,
-			State:       room.State,
-			Players:     playerNames,
-			CreatedAt:   room.StartTime,
-		}
-		
-		rooms = append(rooms, roomResponse)
-		room.mutex.RUnlock()
+	rooms := []RoomResponse{}
+	for _, room := range allRooms() {
+		room.do(func() {
+			// Create player name mapping
+			playerNames := make(map[string]string)
+			for playerID, player := range room.Players {
+				playerNames[playerID] = player.Name
+			}
+
+			rooms = append(rooms, RoomResponse{
+				ID:             room.ID,
+				PlayerCount:    len(room.Players),
+				SpectatorCount: len(room.Spectators),
+				MaxPlayers:     room.MaxPlayers,
+				State:          room.State,
+				Players:        playerNames,
+				Rules:          room.Rules,
+				CreatedAt:      room.StartTime,
+			})
+		})
 	}
-	roomsMutex.RUnlock()
 
 	if err := json.NewEncoder(w).Encode(rooms); err != nil {
 		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
@@ -59,42 +57,42 @@ func createRoom(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var requestData struct {
-		Name       string `json:"name"`
-		MaxPlayers int    `json:"maxPlayers"`
+		Name       string    `json:"name"`
+		MaxPlayers int       `json:"maxPlayers"`
+		Rules      RoomRules `json:"rules"` // Fields left out keep their default
 	}
+	requestData.Rules = defaultRoomRules()
 
 	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	if shuttingDown.Load() {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
 	// Validate input
 	if requestData.Name == "" {
 		http.Error(w, "Room name is required", http.StatusBadRequest)
 		return
 	}
 
+	if fields := validateRules(requestData.Rules); fields != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid rules", fields)
+		return
+	}
+
 	maxPlayers := requestData.MaxPlayers
 	if maxPlayers < 2 || maxPlayers > 4 {
 		maxPlayers = 4 // Default to 4 players
 	}
 
-	// Create new room
+	// Create new room, started once registered
 	roomID := generateRoomID()
-	room := &GameRoom{
-		ID:         roomID,
-		Players:    make(map[string]*Player),
-		Bombs:      make(map[string]*Bomb),
-		Map:        generateMap(),
-		State:      "waiting",
-		MaxPlayers: maxPlayers,
-		Clients:    make(map[string]*Client),
-		StartTime:  time.Now(),
-	}
-
-	roomsMutex.Lock()
-	gameRooms[roomID] = room
-	roomsMutex.Unlock()
+	room := newGameRoom(roomID, maxPlayers, requestData.Rules)
+	room.StartTime = time.Now()
 
 	// Return room info
 	response := RoomResponse{
@@ -103,9 +101,15 @@ func createRoom(w http.ResponseWriter, r *http.Request) {
 		MaxPlayers:  room.MaxPlayers,
 		State:       room.State,
 		Players:     make(map[string]string),
+		Rules:       room.Rules,
 		CreatedAt:   room.StartTime,
 	}
 
+	roomsMutex.Lock()
+	gameRooms[roomID] = room
+	roomsMutex.Unlock()
+	go room.run()
+
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, "Unable to encode response", http.StatusInternalServerError)
 		return
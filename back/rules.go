@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"bomberman-multiplayer/sim"
+)
+
+// Bounds for the rules a host can set when creating a room
+const (
+	MIN_MAP_SIZE        = 7
+	MAX_MAP_SIZE        = 31
+	MAX_CRATE_DENSITY   = 0.9
+	MIN_BOMB_FUSE       = 1 * time.Second
+	MAX_BOMB_FUSE       = 10 * time.Second
+	MIN_FIRE_DURATION   = 100 * time.Millisecond
+	MAX_FIRE_DURATION   = 3 * time.Second
+	MIN_BLAST_RANGE     = 1
+	MAX_BLAST_RANGE     = 10
+	MAX_START_LIVES     = 9
+	MAX_INVULNERABILITY = 10 * time.Second
+	MIN_COUNTDOWN       = 1 * time.Second
+	MAX_COUNTDOWN       = 60 * time.Second
+	MAX_WAITING         = 120 * time.Second
+)
+
+// Rules of a room: the match rules plus the lobby timers
+type RoomRules struct {
+	sim.Rules
+	CountdownMs int `json:"countdownMs"`
+	WaitingMs   int `json:"waitingMs"`
+}
+
+func defaultRoomRules() RoomRules {
+	return RoomRules{
+		Rules:       sim.DefaultRules(),
+		CountdownMs: int(time.Duration(config.Countdown).Milliseconds()),
+		WaitingMs:   int(time.Duration(config.Waiting).Milliseconds()),
+	}
+}
+
+func (r RoomRules) Countdown() time.Duration {
+	return time.Duration(r.CountdownMs) * time.Millisecond
+}
+
+func (r RoomRules) Waiting() time.Duration {
+	return time.Duration(r.WaitingMs) * time.Millisecond
+}
+
+// Check every rule against its bounds, returning an error per invalid field
+func validateRules(rules RoomRules) map[string]string {
+	fields := map[string]string{}
+
+	// Odd sizes keep the pillar grid and the corner spawns clear
+	if rules.MapWidth < MIN_MAP_SIZE || rules.MapWidth > MAX_MAP_SIZE || rules.MapWidth%2 == 0 {
+		fields["rules.mapWidth"] = fmt.Sprintf("must be an odd number between %d and %d", MIN_MAP_SIZE, MAX_MAP_SIZE)
+	}
+	if rules.MapHeight < MIN_MAP_SIZE || rules.MapHeight > MAX_MAP_SIZE || rules.MapHeight%2 == 0 {
+		fields["rules.mapHeight"] = fmt.Sprintf("must be an odd number between %d and %d", MIN_MAP_SIZE, MAX_MAP_SIZE)
+	}
+	if rules.CrateDensity < 0 || rules.CrateDensity > MAX_CRATE_DENSITY {
+		fields["rules.crateDensity"] = fmt.Sprintf("must be between 0 and %g", MAX_CRATE_DENSITY)
+	}
+	if !msWithin(rules.BombFuseMs, MIN_BOMB_FUSE, MAX_BOMB_FUSE) {
+		fields["rules.bombFuseMs"] = fmt.Sprintf("must be between %d and %d", MIN_BOMB_FUSE.Milliseconds(), MAX_BOMB_FUSE.Milliseconds())
+	}
+	if !msWithin(rules.FireDurationMs, MIN_FIRE_DURATION, MAX_FIRE_DURATION) {
+		fields["rules.fireDurationMs"] = fmt.Sprintf("must be between %d and %d", MIN_FIRE_DURATION.Milliseconds(), MAX_FIRE_DURATION.Milliseconds())
+	}
+	if rules.BlastRange < MIN_BLAST_RANGE || rules.BlastRange > MAX_BLAST_RANGE {
+		fields["rules.blastRange"] = fmt.Sprintf("must be between %d and %d", MIN_BLAST_RANGE, MAX_BLAST_RANGE)
+	}
+	if rules.StartLives < 1 || rules.StartLives > MAX_START_LIVES {
+		fields["rules.startLives"] = fmt.Sprintf("must be between 1 and %d", MAX_START_LIVES)
+	}
+	if !msWithin(rules.InvulnerabilityMs, 0, MAX_INVULNERABILITY) {
+		fields["rules.invulnerabilityMs"] = fmt.Sprintf("must be between 0 and %d", MAX_INVULNERABILITY.Milliseconds())
+	}
+	if !msWithin(rules.CountdownMs, MIN_COUNTDOWN, MAX_COUNTDOWN) {
+		fields["rules.countdownMs"] = fmt.Sprintf("must be between %d and %d", MIN_COUNTDOWN.Milliseconds(), MAX_COUNTDOWN.Milliseconds())
+	}
+	if !msWithin(rules.WaitingMs, 0, MAX_WAITING) {
+		fields["rules.waitingMs"] = fmt.Sprintf("must be between 0 and %d", MAX_WAITING.Milliseconds())
+	}
+
+	if len(fields) > 0 {
+		return fields
+	}
+	return nil
+}
+
+// Whether a duration in milliseconds lies within bounds. The raw count is
+// compared, since converting a huge one to a Duration would overflow.
+func msWithin(ms int, min, max time.Duration) bool {
+	return int64(ms) >= min.Milliseconds() && int64(ms) <= max.Milliseconds()
+}
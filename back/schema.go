@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JSON Schema of the WebSocket protocol, generated from the message types
+// so the published schema cannot drift from what the server sends.
+func protocolSchema() map[string]interface{} {
+	defs := map[string]interface{}{}
+	clientRefs := messageSchemas(clientMessages, "Client", false, defs)
+	serverRefs := messageSchemas(serverMessages, "Server", true, defs)
+
+	defs["ClientMessage"] = map[string]interface{}{"oneOf": clientRefs}
+	defs["ServerMessage"] = map[string]interface{}{"oneOf": serverRefs}
+
+	return map[string]interface{}{
+		"$schema":         "https://json-schema.org/draft/2020-12/schema",
+		"title":           "Bomberman multiplayer WebSocket protocol",
+		"protocolVersion": PROTOCOL_VERSION,
+		"anyOf": []interface{}{
+			ref("ClientMessage"),
+			ref("ServerMessage"),
+		},
+		"$defs": defs,
+	}
+}
+
+// Add an envelope schema per message type and return references to them
+func messageSchemas(messages map[string]interface{}, prefix string, withFrom bool, defs map[string]interface{}) []interface{} {
+	types := make([]string, 0, len(messages))
+	for msgType := range messages {
+		types = append(types, msgType)
+	}
+	sort.Strings(types)
+
+	refs := []interface{}{}
+	for _, msgType := range types {
+		properties := map[string]interface{}{
+			"type": map[string]interface{}{"const": msgType},
+		}
+		required := []string{"type"}
+
+		if payload := messages[msgType]; payload != nil {
+			properties["data"] = typeSchema(reflect.TypeOf(payload), defs)
+			required = append(required, "data")
+		}
+		if withFrom {
+			properties["from"] = map[string]interface{}{"type": "string"}
+		}
+
+		name := prefix + strings.ToUpper(msgType[:1]) + msgType[1:]
+		defs[name] = map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+		refs = append(refs, ref(name))
+	}
+	return refs
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/$defs/" + name}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// Schema of a Go type as encoding/json writes it. Named structs are added
+// to defs once and referenced.
+func typeSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		name := defName(t)
+		if _, done := defs[name]; !done {
+			defs[name] = nil // Placeholder for recursive types
+			properties := map[string]interface{}{}
+			required := []string{}
+			structFields(t, properties, &required, defs)
+			sort.Strings(required)
+			defs[name] = map[string]interface{}{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			}
+		}
+		return ref(name)
+	}
+
+	// interface{} and anything else can hold any value
+	return map[string]interface{}{}
+}
+
+// Collect a struct's JSON fields, inlining embedded structs like encoding/json
+func structFields(t reflect.Type, properties map[string]interface{}, required *[]string, defs map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			structFields(fieldType, properties, required, defs)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := typeSchema(field.Type, defs)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = schema
+		if !strings.Contains(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// Definition name of a struct, prefixed with its package outside main so
+// main.Player and sim.Player do not collide
+func defName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	if pkg == "" || pkg == "main" {
+		return t.Name()
+	}
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + t.Name()
+}
+
+func writeProtocolSchema(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(protocolSchema())
+}
+
+// GET /protocol : JSON Schema of the WebSocket messages
+func getProtocolSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	writeProtocolSchema(w)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Shutdown constants
+const (
+	SHUTDOWN_TIMEOUT       = 2 * time.Minute // Default time left to running matches
+	SHUTDOWN_POLL_INTERVAL = 500 * time.Millisecond
+	SHUTDOWN_FLUSH_DELAY   = 1 * time.Second // Lets the last broadcasts reach clients before closing
+)
+
+var (
+	// Set once a shutdown signal is received: no new players or rooms from then on
+	shuttingDown     atomic.Bool
+	shutdownDeadline time.Time
+
+	// Closed once matches are over, to cut the post-game delay short
+	shutdownNow = make(chan struct{})
+
+	// Score and replay writes that must finish before exit
+	pendingWrites sync.WaitGroup
+)
+
+// Snapshot of the current rooms
+func allRooms() []*GameRoom {
+	roomsMutex.RLock()
+	defer roomsMutex.RUnlock()
+
+	rooms := make([]*GameRoom, 0, len(gameRooms))
+	for _, room := range gameRooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+func serverShutdownMessage() Message {
+	return Message{
+		Type: "serverShutdown",
+		Data: ServerShutdownData{
+			Deadline:    shutdownDeadline,
+			RemainingMs: time.Until(shutdownDeadline).Milliseconds(),
+		},
+	}
+}
+
+// Drain the rooms, stop their goroutines, close every connection and wait
+// for the last score and replay writes
+func shutdownRooms(signals <-chan os.Signal) {
+	drainRooms(signals)
+	stopRooms()
+	closeAllClients()
+	close(shutdownNow)
+	pendingWrites.Wait()
+}
+
+// Stop taking players, warn everyone, and wait for running matches to end.
+// Matches still going at the deadline, or after a second signal, are ended
+// on the spot so their scores are kept.
+func drainRooms(signals <-chan os.Signal) {
+	timeout := time.Duration(config.ShutdownTimeout)
+	shutdownDeadline = time.Now().Add(timeout)
+	shuttingDown.Store(true)
+
+	for _, room := range allRooms() {
+		room.post(func() { broadcastToRoom(room, serverShutdownMessage(), "") })
+	}
+
+	ticker := time.NewTicker(SHUTDOWN_POLL_INTERVAL)
+	defer ticker.Stop()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		running := runningMatches()
+		if running == 0 {
+			log.Printf("All matches finished")
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			log.Printf("Shutdown deadline reached, ending %d match(es)", running)
+			endRunningMatches()
+			return
+		case sig := <-signals:
+			log.Printf("Received %s again, ending %d match(es) now", sig, running)
+			endRunningMatches()
+			return
+		}
+	}
+}
+
+// Number of rooms counting down or playing
+func runningMatches() int {
+	running := 0
+	for _, room := range allRooms() {
+		room.do(func() {
+			if room.State == "countdown" || room.State == "playing" {
+				running++
+			}
+		})
+	}
+	return running
+}
+
+// End every match in progress, recording its results
+func endRunningMatches() {
+	for _, room := range allRooms() {
+		room.do(func() {
+			if room.State == "playing" {
+				endGame(room)
+			}
+		})
+	}
+}
+
+// Close every player and spectator connection with a going-away frame, once
+// queued messages such as gameEnded have had time to go out. The room
+// goroutines must be stopped, as this reads their clients directly.
+func closeAllClients() {
+	time.Sleep(SHUTDOWN_FLUSH_DELAY)
+
+	for _, room := range allRooms() {
+		clients := make([]*Client, 0, len(room.Clients)+len(room.Spectators))
+		for _, client := range room.Clients {
+			clients = append(clients, client)
+		}
+		for _, client := range room.Spectators {
+			clients = append(clients, client)
+		}
+
+		for _, client := range clients {
+			closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			client.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+			client.Conn.Close()
+		}
+	}
+}
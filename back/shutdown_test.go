@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// A countdown still running when the server starts shutting down must not
+// turn into a match
+func TestShutdownCancelsCountdown(t *testing.T) {
+	useTestServer(t)
+	config.AutoFillBots = false
+
+	room := getOrCreateRoom("")
+	room.do(func() {
+		for _, name := range []string{"Alice", "Bob"} {
+			addPlayerToRoom(room, nil, name)
+		}
+		startCountdown(room)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		drainRooms(nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Duration(config.Countdown)): // Before the match would start
+		t.Fatal("shutdown still waiting on the room")
+	}
+
+	state := ""
+	room.do(func() { state = room.State })
+	if state != "waiting" {
+		t.Errorf("room is %s after the drain, want waiting", state)
+	}
+
+	room.do(func() { removeRoom(room) })
+	<-room.done
+}
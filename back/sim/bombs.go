@@ -0,0 +1,412 @@
+package sim
+
+import "sort"
+
+// Blast of a single bomb within a chain reaction
+type BombBlast struct {
+	BombID     string  `json:"bombId"`
+	PlayerID   string  `json:"playerId"`
+	Explosions [][]int `json:"explosions"`
+}
+
+// Player hit by a bomb's blast or fire, sent as a playerHit event. X and Y
+// are where the player stands after the hit, which is their spawn corner
+// when they respawned.
+type BombHit struct {
+	PlayerID          string `json:"playerId"`
+	BombID            string `json:"bombId"`
+	AttackerID        string `json:"attackerId"`
+	Lives             int    `json:"lives"`
+	X                 int    `json:"x"`
+	Y                 int    `json:"y"`
+	Respawned         bool   `json:"respawned"`
+	InvulnerableUntil int64  `json:"invulnerableUntil"` // Match time in ms, 0 once eliminated
+	InvulnerableMs    int64  `json:"invulnerableMs"`
+}
+
+// Drop a bomb under the player if they have one left
+func (s *State) placeBomb(player *Player) []Event {
+	// Check if player can place bomb
+	playerBombs := 0
+	for _, bomb := range s.Bombs {
+		if bomb.PlayerID == player.ID {
+			playerBombs++
+		}
+	}
+
+	maxBombs := 1 + player.PowerUps.Bombs
+	if playerBombs >= maxBombs {
+		return nil
+	}
+
+	// Check if there's already a bomb at player position
+	if s.bombAt(player.X, player.Y) != nil {
+		return nil
+	}
+
+	bomb := &Bomb{
+		ID:       s.newID("bomb"),
+		X:        player.X,
+		Y:        player.Y,
+		PlayerID: player.ID,
+		Timer:    s.Rules.BombFuseMs,
+		PlacedAt: s.Now,
+	}
+	s.Bombs[bomb.ID] = bomb
+
+	placed := *bomb
+	return []Event{{Type: "bombPlaced", From: player.ID, Data: &placed}}
+}
+
+// Detonate every bomb whose fuse has run out
+func (s *State) updateBombs() []Event {
+	// Collect expired fuses and bombs pushed or dropped into fire, in a deterministic order
+	expired := []*Bomb{}
+	for _, bomb := range s.Bombs {
+		if s.Now-bomb.PlacedAt >= s.Rules.BombFuse() || s.onFire(bomb.X, bomb.Y) {
+			expired = append(expired, bomb)
+		}
+	}
+	sortBombs(expired)
+
+	events := []Event{}
+	for _, bomb := range expired {
+		// Skip bombs already set off by an earlier chain this tick
+		if _, exists := s.Bombs[bomb.ID]; !exists {
+			continue
+		}
+		events = append(events, s.explodeChain(bomb)...)
+	}
+	return events
+}
+
+// Order bombs by placement time, then by ID
+func sortBombs(bombs []*Bomb) {
+	sort.Slice(bombs, func(i, j int) bool {
+		if bombs[i].PlacedAt != bombs[j].PlacedAt {
+			return bombs[i].PlacedAt < bombs[j].PlacedAt
+		}
+		return bombs[i].ID < bombs[j].ID
+	})
+}
+
+// Detonate a bomb and every bomb caught in its blast, breadth-first
+func (s *State) explodeChain(root *Bomb) []Event {
+	queue := []*Bomb{root}
+	delete(s.Bombs, root.ID)
+
+	destroyed := make(map[[2]int]bool) // Crates broken earlier in this chain
+	hitPlayers := make(map[string]bool)
+	seen := make(map[[2]int]bool)
+
+	bombIDs := []string{}
+	blasts := []BombBlast{}
+	hits := []BombHit{}
+	explosions := [][]int{}
+	spawned := []*PowerUp{}
+
+	for len(queue) > 0 {
+		bomb := queue[0]
+		queue = queue[1:]
+
+		cells, powerUps := s.explodeBomb(bomb, destroyed)
+		spawned = append(spawned, powerUps...)
+		bombIDs = append(bombIDs, bomb.ID)
+		blasts = append(blasts, BombBlast{
+			BombID:     bomb.ID,
+			PlayerID:   bomb.PlayerID,
+			Explosions: cells,
+		})
+
+		for _, cell := range cells {
+			key := [2]int{cell[0], cell[1]}
+			if !seen[key] {
+				seen[key] = true
+				explosions = append(explosions, cell)
+			}
+		}
+
+		// The first bomb of the chain to reach a player gets the hit
+		s.ignite(bomb, cells, hitPlayers)
+		hits = append(hits, s.damagePlayers(bomb, cells, hitPlayers)...)
+
+		// Bombs caught in the blast go off next, in blast order
+		for _, cell := range cells {
+			if other := s.bombAt(cell[0], cell[1]); other != nil {
+				delete(s.Bombs, other.ID)
+				queue = append(queue, other)
+			}
+		}
+	}
+
+	// The whole chain is reported as one explosion
+	events := []Event{{
+		Type: "bombExploded",
+		Data: &BombExploded{
+			BombID:         root.ID,
+			BombIDs:        bombIDs,
+			Blasts:         blasts,
+			Explosions:     explosions,
+			Hits:           hits,
+			Map:            s.copyMap(),
+			Players:        s.copyPlayers(),
+			FireDurationMs: s.Rules.FireDurationMs,
+		},
+	}}
+
+	for _, hit := range hits {
+		events = append(events, Event{Type: "playerHit", Data: hit})
+	}
+	events = append(events, s.burnPowerUps(explosions, spawned)...)
+	for _, powerUp := range spawned {
+		events = append(events, Event{Type: "powerUpSpawned", Data: powerUp})
+	}
+
+	return events
+}
+
+// Handle a single bomb explosion, returning the blast cells and any dropped power-ups
+func (s *State) explodeBomb(bomb *Bomb, destroyed map[[2]int]bool) ([][]int, []*PowerUp) {
+	// Get explosion range
+	explosionRange := s.BlastRange(bomb.PlayerID)
+	owner, ownerExists := s.Players[bomb.PlayerID]
+
+	// Calculate explosion positions
+	explosions := [][]int{{bomb.X, bomb.Y}} // Center
+	spawned := []*PowerUp{}
+
+	// Add explosion in 4 directions
+	directions := [][]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}} // up, down, left, right
+	for _, dir := range directions {
+		for i := 1; i <= explosionRange; i++ {
+			x := bomb.X + dir[0]*i
+			y := bomb.Y + dir[1]*i
+
+			// Check bounds
+			if x < 0 || x >= s.Rules.MapWidth || y < 0 || y >= s.Rules.MapHeight {
+				break
+			}
+
+			// Solid walls stop the explosion
+			if s.Map[y][x] == TILE_WALL {
+				break
+			}
+
+			explosions = append(explosions, []int{x, y})
+
+			// A crate broken earlier in the chain still stops this blast
+			if destroyed[[2]int{x, y}] {
+				break
+			}
+
+			// Destroy crates, which also stop the explosion
+			if s.Map[y][x] == TILE_CRATE {
+				s.Map[y][x] = TILE_EMPTY
+				destroyed[[2]int{x, y}] = true
+				if ownerExists {
+					owner.Score += SCORE_CRATE
+					owner.Stats.CratesDestroyed++
+				}
+				if powerUp := s.maybeSpawnPowerUp(x, y); powerUp != nil {
+					spawned = append(spawned, powerUp)
+				}
+				break
+			}
+		}
+	}
+
+	return explosions, spawned
+}
+
+// Damage players standing in a blast who were not already hit in this chain
+func (s *State) damagePlayers(bomb *Bomb, cells [][]int, hitPlayers map[string]bool) []BombHit {
+	hits := []BombHit{}
+	for _, playerID := range s.sortedPlayerIDs() {
+		player := s.Players[playerID]
+		if player.Lives <= 0 || hitPlayers[playerID] || s.Invulnerable(player) {
+			continue
+		}
+
+		for _, cell := range cells {
+			if player.X == cell[0] && player.Y == cell[1] {
+				hitPlayers[playerID] = true
+				hits = append(hits, s.hurt(player, bomb.ID, bomb.PlayerID))
+				break
+			}
+		}
+	}
+
+	return hits
+}
+
+// Take a life from a player hit by attackerID's bomb. Survivors are
+// protected for a while, and sent back to their corner if the rules say so.
+func (s *State) hurt(player *Player, bombID, attackerID string) BombHit {
+	player.Lives--
+	player.Stats.LivesLost++
+
+	hit := BombHit{
+		PlayerID:   player.ID,
+		BombID:     bombID,
+		AttackerID: attackerID,
+		Lives:      player.Lives,
+	}
+
+	if player.Lives <= 0 {
+		s.creditElimination(attackerID, player)
+	} else {
+		player.InvulnerableUntil = s.Now + s.Rules.Invulnerability()
+		hit.InvulnerableUntil = player.InvulnerableUntil.Milliseconds()
+		hit.InvulnerableMs = s.Rules.Invulnerability().Milliseconds()
+
+		if s.Rules.RespawnOnHit {
+			s.respawn(player)
+			hit.Respawned = true
+		}
+	}
+
+	hit.X = player.X
+	hit.Y = player.Y
+	return hit
+}
+
+// Whether a player is still protected after their last hit
+func (s *State) Invulnerable(player *Player) bool {
+	return s.Now < player.InvulnerableUntil
+}
+
+// Send a player back to their spawn corner, dropping any queued move
+func (s *State) respawn(player *Player) {
+	player.X = player.SpawnX
+	player.Y = player.SpawnY
+	player.QueuedMove = ""
+}
+
+// Score an elimination for the bomb owner, or penalise a self-kill
+func (s *State) creditElimination(attackerID string, victim *Player) {
+	victim.EliminatedAt = s.Now
+
+	if attackerID == victim.ID {
+		victim.Score += SCORE_SELF_KILL
+		victim.Stats.SelfKills++
+		return
+	}
+
+	if owner, exists := s.Players[attackerID]; exists {
+		owner.Score += SCORE_KILL
+		owner.Stats.Kills++
+	}
+}
+
+// Start the bomb at (x, y) sliding in direction (dx, dy)
+func (s *State) kickBomb(x, y, dx, dy int) *Bomb {
+	bomb := s.bombAt(x, y)
+	if bomb == nil || bomb.SlideDX != 0 || bomb.SlideDY != 0 {
+		return nil
+	}
+
+	// Nothing happens if the bomb is already against an obstacle
+	if !s.canBombSlideTo(x+dx, y+dy) {
+		return nil
+	}
+
+	bomb.SlideDX = dx
+	bomb.SlideDY = dy
+	bomb.NextSlideAt = s.Now // First step on the next tick
+
+	return bomb
+}
+
+// Move kicked bombs one tile per BOMB_SLIDE_INTERVAL until they hit something
+func (s *State) slideBombs() []Event {
+	sliding := []*Bomb{}
+	for _, bomb := range s.Bombs {
+		if bomb.SlideDX != 0 || bomb.SlideDY != 0 {
+			sliding = append(sliding, bomb)
+		}
+	}
+	sortBombs(sliding)
+
+	events := []Event{}
+	for _, bomb := range sliding {
+		if s.Now < bomb.NextSlideAt {
+			continue
+		}
+
+		x, y := bomb.X+bomb.SlideDX, bomb.Y+bomb.SlideDY
+		if !s.canBombSlideTo(x, y) {
+			bomb.SlideDX, bomb.SlideDY = 0, 0
+			continue
+		}
+
+		bomb.X = x
+		bomb.Y = y
+		bomb.NextSlideAt = s.Now + BOMB_SLIDE_INTERVAL
+
+		events = append(events, Event{
+			Type: "bombMoved",
+			Data: &BombMoved{BombID: bomb.ID, X: x, Y: y},
+		})
+	}
+	return events
+}
+
+// Check if a sliding bomb can enter a tile (free of walls, crates, bombs and players)
+func (s *State) canBombSlideTo(x, y int) bool {
+	if !s.IsWalkable(x, y) {
+		return false
+	}
+
+	for _, player := range s.Players {
+		if player.Lives > 0 && player.X == x && player.Y == y {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Find the bomb at a position, if any
+func (s *State) bombAt(x, y int) *Bomb {
+	for _, bomb := range s.Bombs {
+		if bomb.X == x && bomb.Y == y {
+			return bomb
+		}
+	}
+	return nil
+}
+
+// Roll a power-up drop for a destroyed crate
+func (s *State) maybeSpawnPowerUp(x, y int) *PowerUp {
+	if s.rng.Float32() >= POWERUP_DROP_CHANCE {
+		return nil
+	}
+
+	powerUp := &PowerUp{
+		ID:   s.newID("powerup"),
+		X:    x,
+		Y:    y,
+		Type: powerUpTypes[s.rng.Intn(len(powerUpTypes))],
+	}
+	s.PowerUps[powerUp.ID] = powerUp
+
+	return powerUp
+}
+
+// Copy of the map, safe to hand to another goroutine
+func (s *State) copyMap() [][]int {
+	gameMap := make([][]int, len(s.Map))
+	for y, row := range s.Map {
+		gameMap[y] = append([]int(nil), row...)
+	}
+	return gameMap
+}
+
+// Copy of the players, safe to hand to another goroutine
+func (s *State) copyPlayers() map[string]Player {
+	players := make(map[string]Player, len(s.Players))
+	for playerID, player := range s.Players {
+		players[playerID] = *player
+	}
+	return players
+}
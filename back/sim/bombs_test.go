@@ -0,0 +1,227 @@
+package sim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChainReaction(t *testing.T) {
+	tests := []struct {
+		name     string
+		victimX  int
+		attacker string // Owner credited with the kill
+	}{
+		{"in the first blast", 4, "a"},
+		{"in the second and third blasts", 6, "b"},
+		{"in the third blast only", 8, "c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultRules()
+			rules.StartLives = 1
+			s := openState(rules)
+
+			// Bomb owners stand out of reach, on row 9
+			addPlayerAt(s, "a", 1, 9)
+			addPlayerAt(s, "b", 5, 9)
+			addPlayerAt(s, "c", 9, 9)
+			victim := addPlayerAt(s, "victim", tt.victimX, 3)
+
+			// Only the first bomb's fuse runs out, the others are set off by it
+			first := addBombAt(s, "a", 3, 3, 0)
+			second := addBombAt(s, "b", 5, 3, time.Second)
+			third := addBombAt(s, "c", 7, 3, time.Second)
+
+			events := advance(s, rules.BombFuse())
+
+			exploded := eventsOfType(events, "bombExploded")
+			if len(exploded) != 1 {
+				t.Fatalf("got %d bombExploded events, want one for the whole chain", len(exploded))
+			}
+			chain := exploded[0].Data.(*BombExploded)
+			want := []string{first.ID, second.ID, third.ID}
+			if !reflect.DeepEqual(chain.BombIDs, want) {
+				t.Errorf("bombs went off in order %v, want %v", chain.BombIDs, want)
+			}
+			if len(s.Bombs) != 0 {
+				t.Errorf("%d bombs left after the chain", len(s.Bombs))
+			}
+
+			if victim.Lives != 0 {
+				t.Fatalf("victim has %d lives, want 0", victim.Lives)
+			}
+			if len(chain.Hits) != 1 || chain.Hits[0].AttackerID != tt.attacker {
+				t.Fatalf("hits %+v, want one credited to %s", chain.Hits, tt.attacker)
+			}
+			for _, owner := range []string{"a", "b", "c"} {
+				kills, score := 0, 0
+				if owner == tt.attacker {
+					kills, score = 1, SCORE_KILL
+				}
+				if got := s.Players[owner]; got.Stats.Kills != kills || got.Score != score {
+					t.Errorf("%s has %d kills and %d points, want %d and %d", owner, got.Stats.Kills, got.Score, kills, score)
+				}
+			}
+		})
+	}
+}
+
+func TestKick(t *testing.T) {
+	tests := []struct {
+		name    string
+		kick    bool
+		crateX  int // Crate on the bomb's row, 0 for none
+		blocker int // X of another player on the bomb's row, 0 for none
+		wantX   int // Where the bomb ends up
+	}{
+		{"without the power-up", false, 0, 0, 4},
+		{"slides to the wall", true, 0, 0, 13},
+		{"stops at a crate", true, 8, 0, 7},
+		{"stops at a player", true, 0, 6, 5},
+		{"already against a crate", true, 5, 0, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openState(DefaultRules())
+			kicker := addPlayerAt(s, "kicker", 3, 5)
+			kicker.PowerUps.Kick = tt.kick
+			if tt.crateX != 0 {
+				s.Map[5][tt.crateX] = TILE_CRATE
+			}
+			if tt.blocker != 0 {
+				addPlayerAt(s, "blocker", tt.blocker, 5)
+			}
+			bomb := addBombAt(s, "kicker", 4, 5, 0)
+
+			_, events := Step(s, []Input{{PlayerID: "kicker", Type: "move", Direction: "right"}}, TEST_TICK)
+			events = append(events, advance(s, 1500*time.Millisecond)...) // Still short of the fuse
+
+			if kicker.X != 3 {
+				t.Errorf("kicker moved to x=%d, want to stay at 3", kicker.X)
+			}
+			if bomb.X != tt.wantX || bomb.Y != 5 {
+				t.Errorf("bomb at (%d, %d), want (%d, 5)", bomb.X, bomb.Y, tt.wantX)
+			}
+			if moved := len(eventsOfType(events, "bombMoved")); moved != tt.wantX-4 {
+				t.Errorf("got %d bombMoved events, want %d", moved, tt.wantX-4)
+			}
+			if bomb.SlideDX != 0 || bomb.SlideDY != 0 {
+				t.Error("bomb is still sliding")
+			}
+		})
+	}
+}
+
+func TestSlideTakesOneIntervalPerTile(t *testing.T) {
+	s := openState(DefaultRules())
+	kicker := addPlayerAt(s, "kicker", 3, 5)
+	kicker.PowerUps.Kick = true
+	addBombAt(s, "kicker", 4, 5, 0)
+
+	inputs := []Input{{PlayerID: "kicker", Type: "move", Direction: "right"}}
+	moves := []time.Duration{}
+	wantX := 5
+	for end := s.Now + time.Second; s.Now < end; inputs = nil {
+		_, events := Step(s, inputs, TEST_TICK)
+		for _, event := range eventsOfType(events, "bombMoved") {
+			if moved := event.Data.(*BombMoved); moved.X != wantX {
+				t.Fatalf("bomb moved to x=%d, want one tile to %d", moved.X, wantX)
+			}
+			wantX++
+			moves = append(moves, s.Now)
+		}
+	}
+
+	// One tile on the tick after the kick, then one per interval, rounded up to a tick
+	if len(moves) == 0 || moves[0] != TEST_TICK {
+		t.Fatalf("bomb moved at %v, want a first move at %s", moves, TEST_TICK)
+	}
+	for i := 1; i < len(moves); i++ {
+		if gap := moves[i] - moves[i-1]; gap < BOMB_SLIDE_INTERVAL || gap >= BOMB_SLIDE_INTERVAL+TEST_TICK {
+			t.Errorf("move %d came %s after the previous one, want %s", i, gap, BOMB_SLIDE_INTERVAL)
+		}
+	}
+}
+
+func TestInvulnerabilityAndRespawn(t *testing.T) {
+	tests := []struct {
+		name    string
+		respawn bool
+	}{
+		{"staying put", false},
+		{"respawning", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultRules()
+			rules.RespawnOnHit = tt.respawn
+			s := openState(rules)
+			addPlayerAt(s, "attacker", 1, 11)
+			victim := s.AddPlayer("victim", "victim") // Spawns in the top-right corner
+			victim.X, victim.Y = 7, 5
+
+			// Set off a bomb under the victim on the next tick
+			detonate := func() []BombHit {
+				addBombAt(s, "attacker", victim.X, victim.Y, s.Now-rules.BombFuse()+TEST_TICK)
+				_, events := Step(s, nil, TEST_TICK)
+				hits := []BombHit{}
+				for _, event := range eventsOfType(events, "playerHit") {
+					hits = append(hits, event.Data.(BombHit))
+				}
+				return hits
+			}
+
+			hits := detonate()
+			if len(hits) != 1 || victim.Lives != rules.StartLives-1 {
+				t.Fatalf("first bomb: %d hits and %d lives, want 1 and %d", len(hits), victim.Lives, rules.StartLives-1)
+			}
+			if !s.Invulnerable(victim) || victim.InvulnerableUntil != s.Now+rules.Invulnerability() {
+				t.Errorf("victim protected until %s at %s, want %s more", victim.InvulnerableUntil, s.Now, rules.Invulnerability())
+			}
+			if hits[0].Respawned != tt.respawn {
+				t.Errorf("respawned = %v, want %v", hits[0].Respawned, tt.respawn)
+			}
+			wantX, wantY := 7, 5
+			if tt.respawn {
+				wantX, wantY = victim.SpawnX, victim.SpawnY
+			}
+			if victim.X != wantX || victim.Y != wantY || hits[0].X != wantX || hits[0].Y != wantY {
+				t.Errorf("victim at (%d, %d), hit reports (%d, %d), want (%d, %d)", victim.X, victim.Y, hits[0].X, hits[0].Y, wantX, wantY)
+			}
+
+			// Protected for a while
+			advance(s, rules.Invulnerability()/2)
+			if hits := detonate(); len(hits) != 0 || victim.Lives != rules.StartLives-1 {
+				t.Errorf("protected victim took %d hits, %d lives left", len(hits), victim.Lives)
+			}
+
+			// Then hurt again
+			advance(s, rules.Invulnerability())
+			if s.Invulnerable(victim) {
+				t.Fatal("victim is still protected")
+			}
+			if hits := detonate(); len(hits) != 1 || victim.Lives != rules.StartLives-2 {
+				t.Errorf("victim took %d hits once unprotected, %d lives left", len(hits), victim.Lives)
+			}
+		})
+	}
+}
+
+func TestLastLifeIsNotProtected(t *testing.T) {
+	rules := DefaultRules()
+	rules.StartLives = 1
+	s := openState(rules)
+	addPlayerAt(s, "attacker", 1, 11)
+	victim := addPlayerAt(s, "victim", 7, 5)
+
+	addBombAt(s, "attacker", 7, 5, 0)
+	advance(s, rules.BombFuse())
+
+	if victim.Lives != 0 || victim.EliminatedAt != s.Now || victim.InvulnerableUntil != 0 {
+		t.Errorf("victim has %d lives, eliminated at %s, protected until %s", victim.Lives, victim.EliminatedAt, victim.InvulnerableUntil)
+	}
+}
@@ -0,0 +1,97 @@
+package sim
+
+import "time"
+
+// Time left before each tile is caught in an explosion, following chain
+// reactions, or 0 for tiles on fire. Tiles missing from the map are not threatened.
+type DangerMap map[[2]int]time.Duration
+
+// Danger from the bombs currently on the map
+func (s *State) Danger() DangerMap {
+	return s.danger(nil)
+}
+
+// Danger as it would be if playerID dropped a bomb at (x, y) now
+func (s *State) DangerWithBomb(x, y int, playerID string) DangerMap {
+	return s.danger(&Bomb{X: x, Y: y, PlayerID: playerID, PlacedAt: s.Now})
+}
+
+func (s *State) danger(extra *Bomb) DangerMap {
+	bombs := make([]*Bomb, 0, len(s.Bombs)+1)
+	for _, bomb := range s.Bombs {
+		bombs = append(bombs, bomb)
+	}
+	if extra != nil {
+		bombs = append(bombs, extra)
+	}
+	sortBombs(bombs)
+
+	fuses := make([]time.Duration, len(bombs))
+	cells := make([][][]int, len(bombs))
+	for i, bomb := range bombs {
+		fuses[i] = bomb.PlacedAt + s.Rules.BombFuse() - s.Now
+		if fuses[i] < 0 {
+			fuses[i] = 0
+		}
+		cells[i] = s.BlastCells(bomb.X, bomb.Y, s.BlastRange(bomb.PlayerID))
+	}
+
+	// A bomb caught in another's blast goes off with it
+	for changed := true; changed; {
+		changed = false
+		for i := range bombs {
+			for _, cell := range cells[i] {
+				for j, other := range bombs {
+					if other.X == cell[0] && other.Y == cell[1] && fuses[i] < fuses[j] {
+						fuses[j] = fuses[i]
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	// Tiles still burning are dangerous right now
+	danger := DangerMap{}
+	for key := range s.Fires {
+		danger[key] = 0
+	}
+	for i := range bombs {
+		for _, cell := range cells[i] {
+			key := [2]int{cell[0], cell[1]}
+			if fuse, exists := danger[key]; !exists || fuses[i] < fuse {
+				danger[key] = fuses[i]
+			}
+		}
+	}
+	return danger
+}
+
+// Blast radius of a bomb owned by playerID
+func (s *State) BlastRange(playerID string) int {
+	explosionRange := s.Rules.BlastRange
+	if player, exists := s.Players[playerID]; exists {
+		explosionRange += player.PowerUps.Flames
+	}
+	return explosionRange
+}
+
+// Tiles a blast at (x, y) would reach on the current map, without
+// destroying anything. Walls stop it, crates are reached and stop it.
+func (s *State) BlastCells(x, y, explosionRange int) [][]int {
+	cells := [][]int{{x, y}}
+	directions := [][]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}} // up, down, left, right
+	for _, dir := range directions {
+		for i := 1; i <= explosionRange; i++ {
+			cx, cy := x+dir[0]*i, y+dir[1]*i
+			if cx < 0 || cx >= s.Rules.MapWidth || cy < 0 || cy >= s.Rules.MapHeight || s.Map[cy][cx] == TILE_WALL {
+				break
+			}
+			cells = append(cells, []int{cx, cy})
+			if s.Map[cy][cx] == TILE_CRATE {
+				break
+			}
+		}
+	}
+	return cells
+}
@@ -0,0 +1,39 @@
+package sim
+
+// Event payloads that have no matching state type. Bombs, power-ups and
+// hits are sent as Bomb, PowerUp and BombHit.
+
+type PlayerMoved struct {
+	PlayerID string `json:"playerId"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+}
+
+type PowerUpCollected struct {
+	PlayerID  string   `json:"playerId"`
+	PowerUpID string   `json:"powerUpId"`
+	Type      string   `json:"type"`
+	PowerUps  PowerUps `json:"powerUps"` // The player's counters after pickup
+}
+
+// A whole chain reaction, reported as one explosion
+type BombExploded struct {
+	BombID         string            `json:"bombId"`  // Bomb that started the chain
+	BombIDs        []string          `json:"bombIds"` // Every bomb that went off, in order
+	Blasts         []BombBlast       `json:"blasts"`
+	Explosions     [][]int           `json:"explosions"` // Union of the blast cells
+	Hits           []BombHit         `json:"hits"`
+	Map            [][]int           `json:"map,omitempty"`     // Left out of state deltas
+	Players        map[string]Player `json:"players,omitempty"` // Left out of state deltas
+	FireDurationMs int               `json:"fireDurationMs"`
+}
+
+type BombMoved struct {
+	BombID string `json:"bombId"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+}
+
+type PowerUpDestroyed struct {
+	PowerUpID string `json:"powerUpId"`
+}
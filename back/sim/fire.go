@@ -0,0 +1,120 @@
+package sim
+
+import (
+	"sort"
+	"time"
+)
+
+// A tile still burning after an explosion
+type Fire struct {
+	X         int
+	Y         int
+	BombID    string
+	PlayerID  string // Owner of the bomb, credited for kills
+	ExpiresAt time.Duration
+	hit       map[string]bool // Players already hurt by this chain
+}
+
+// Fire as sent to clients
+type ActiveFire struct {
+	X           int    `json:"x"`
+	Y           int    `json:"y"`
+	PlayerID    string `json:"playerId"`
+	RemainingMs int64  `json:"remainingMs"`
+}
+
+// Active fires in a stable order, for snapshots
+func (s *State) ActiveFires() []ActiveFire {
+	fires := make([]ActiveFire, 0, len(s.Fires))
+	for _, fire := range s.Fires {
+		fires = append(fires, ActiveFire{
+			X:           fire.X,
+			Y:           fire.Y,
+			PlayerID:    fire.PlayerID,
+			RemainingMs: (fire.ExpiresAt - s.Now).Milliseconds(),
+		})
+	}
+	sort.Slice(fires, func(i, j int) bool {
+		if fires[i].Y != fires[j].Y {
+			return fires[i].Y < fires[j].Y
+		}
+		return fires[i].X < fires[j].X
+	})
+	return fires
+}
+
+// Set a blast's cells on fire. Every fire of a chain shares its hit set,
+// so a chain hurts each player at most once.
+func (s *State) ignite(bomb *Bomb, cells [][]int, hit map[string]bool) {
+	for _, cell := range cells {
+		s.Fires[[2]int{cell[0], cell[1]}] = &Fire{
+			X:         cell[0],
+			Y:         cell[1],
+			BombID:    bomb.ID,
+			PlayerID:  bomb.PlayerID,
+			ExpiresAt: s.Now + s.Rules.FireDuration(),
+			hit:       hit,
+		}
+	}
+}
+
+func (s *State) onFire(x, y int) bool {
+	_, burning := s.Fires[[2]int{x, y}]
+	return burning
+}
+
+// Remove fires that burned out
+func (s *State) expireFires() {
+	for key, fire := range s.Fires {
+		if s.Now >= fire.ExpiresAt {
+			delete(s.Fires, key)
+		}
+	}
+}
+
+// Damage players who walked into a fire that has not hurt them yet
+func (s *State) burnPlayers() []Event {
+	events := []Event{}
+	for _, playerID := range s.sortedPlayerIDs() {
+		player := s.Players[playerID]
+		fire, burning := s.Fires[[2]int{player.X, player.Y}]
+		if player.Lives <= 0 || !burning || fire.hit[playerID] || s.Invulnerable(player) {
+			continue
+		}
+
+		fire.hit[playerID] = true
+		events = append(events, Event{
+			Type: "playerHit",
+			Data: s.hurt(player, fire.BombID, fire.PlayerID),
+		})
+	}
+	return events
+}
+
+// Destroy power-ups lying in a blast, except those it just uncovered
+func (s *State) burnPowerUps(cells [][]int, spawned []*PowerUp) []Event {
+	uncovered := make(map[string]bool, len(spawned))
+	for _, powerUp := range spawned {
+		uncovered[powerUp.ID] = true
+	}
+
+	burnt := []*PowerUp{}
+	for _, cell := range cells {
+		for _, powerUp := range s.PowerUps {
+			if powerUp.X == cell[0] && powerUp.Y == cell[1] && !uncovered[powerUp.ID] {
+				burnt = append(burnt, powerUp)
+			}
+		}
+	}
+	sort.Slice(burnt, func(i, j int) bool { return burnt[i].ID < burnt[j].ID })
+
+	events := []Event{}
+	for _, powerUp := range burnt {
+		delete(s.PowerUps, powerUp.ID)
+		events = append(events, Event{
+			Type: "powerUpDestroyed",
+			Data: &PowerUpDestroyed{PowerUpID: powerUp.ID},
+		})
+	}
+	return events
+}
@@ -0,0 +1,81 @@
+package sim
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFireHitsOncePerChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		bombX    []int // Bombs on the victim's row
+		placedAt []time.Duration
+		wantHits int
+	}{
+		// The second bomb is set off by the first, the victim stands in both blasts
+		{"two blasts of one chain", []int{3, 5}, []time.Duration{0, time.Second}, 1},
+		// Out of each other's reach, the second bomb goes off while the first still burns
+		{"two separate chains", []int{2, 6}, []time.Duration{0, 300 * time.Millisecond}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultRules()
+			rules.InvulnerabilityMs = 0
+			s := openState(rules)
+			addPlayerAt(s, "attacker", 1, 11)
+			victim := addPlayerAt(s, "victim", 4, 3)
+
+			for i, x := range tt.bombX {
+				addBombAt(s, "attacker", x, 3, tt.placedAt[i])
+			}
+
+			// Stand in the fire until every bomb went off and burned out
+			events := advance(s, rules.BombFuse()+time.Second+rules.FireDuration())
+			if len(s.Bombs) != 0 || len(s.Fires) != 0 {
+				t.Fatalf("%d bombs and %d fires left", len(s.Bombs), len(s.Fires))
+			}
+
+			if hits := len(eventsOfType(events, "playerHit")); hits != tt.wantHits {
+				t.Errorf("got %d hits, want %d", hits, tt.wantHits)
+			}
+			if victim.Lives != rules.StartLives-tt.wantHits {
+				t.Errorf("victim has %d lives, want %d", victim.Lives, rules.StartLives-tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestWalkingIntoFire(t *testing.T) {
+	rules := DefaultRules()
+	rules.InvulnerabilityMs = 0
+	s := openState(rules)
+	addPlayerAt(s, "attacker", 1, 11)
+	victim := addPlayerAt(s, "victim", 8, 5) // Just out of the blast
+
+	addBombAt(s, "attacker", 5, 5, 0)
+	events := advance(s, rules.BombFuse())
+	if !s.onFire(7, 5) || s.onFire(8, 5) {
+		t.Fatal("the blast should burn up to x=7 only")
+	}
+
+	// In, out and back in while the fire burns
+	for i, direction := range []string{"left", "right", "left"} {
+		if i > 0 {
+			events = append(events, advance(s, MoveCooldown(victim))...)
+		}
+		_, stepEvents := Step(s, []Input{{PlayerID: "victim", Type: "move", Direction: direction}}, TEST_TICK)
+		events = append(events, stepEvents...)
+	}
+	if victim.X != 7 || !s.onFire(7, 5) {
+		t.Fatalf("victim at x=%d, fire out: %v; the test needs them back in the fire", victim.X, !s.onFire(7, 5))
+	}
+
+	hits := eventsOfType(events, "playerHit")
+	if len(hits) != 1 || victim.Lives != rules.StartLives-1 {
+		t.Fatalf("got %d hits and %d lives, want 1 hit", len(hits), victim.Lives)
+	}
+	if hit := hits[0].Data.(BombHit); hit.AttackerID != "attacker" || hit.X != 7 {
+		t.Errorf("hit %+v, want one from attacker's fire at x=7", hit)
+	}
+}
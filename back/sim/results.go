@@ -0,0 +1,79 @@
+package sim
+
+import "sort"
+
+// Final standing of a player, published in gameEnded
+type PlayerResult struct {
+	PlayerID  string      `json:"playerId"`
+	Name      string      `json:"name"`
+	Placement int         `json:"placement"`
+	Score     int         `json:"score"`
+	Lives     int         `json:"lives"`
+	Stats     PlayerStats `json:"stats"`
+	Winner    bool        `json:"winner"`
+	Left      bool        `json:"left,omitempty"` // Forfeited before the end
+}
+
+// Whether the match is over: at most one player is still alive
+func (s *State) Over() bool {
+	return s.AlivePlayers() <= 1
+}
+
+// Close the match: award the win bonus to the last player standing and rank
+// everyone. Returns the winner, or nil for a draw or a match stopped early.
+func (s *State) Finish() (*Player, []PlayerResult) {
+	var winner *Player
+	if s.AlivePlayers() == 1 {
+		for _, player := range s.Players {
+			if player.Lives > 0 {
+				winner = player
+			}
+		}
+	}
+
+	if winner != nil {
+		winner.Score += SCORE_WIN
+	}
+
+	return winner, s.results(winner)
+}
+
+// Rank players for the end of game summary, including those who forfeited:
+// winner first, then by how long they survived
+func (s *State) results(winner *Player) []PlayerResult {
+	players := make([]*Player, 0, len(s.Players)+len(s.Departed))
+	for _, playerID := range s.sortedPlayerIDs() {
+		players = append(players, s.Players[playerID])
+	}
+	players = append(players, s.Departed...)
+
+	sort.SliceStable(players, func(i, j int) bool {
+		a, b := players[i], players[j]
+		if (a == winner) != (b == winner) {
+			return a == winner
+		}
+		if a.Lives != b.Lives {
+			return a.Lives > b.Lives
+		}
+		if a.EliminatedAt != b.EliminatedAt {
+			return a.EliminatedAt > b.EliminatedAt
+		}
+		return a.Score > b.Score
+	})
+
+	results := make([]PlayerResult, 0, len(players))
+	for i, player := range players {
+		results = append(results, PlayerResult{
+			PlayerID:  player.ID,
+			Name:      player.Name,
+			Placement: i + 1,
+			Score:     player.Score,
+			Lives:     player.Lives,
+			Stats:     player.Stats,
+			Winner:    player == winner,
+			Left:      player.Left,
+		})
+	}
+
+	return results
+}
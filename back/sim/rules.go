@@ -0,0 +1,64 @@
+package sim
+
+import "time"
+
+// Match rules a room can change. Zero values are not valid: start from
+// DefaultRules and override fields.
+type Rules struct {
+	MapWidth          int     `json:"mapWidth"`
+	MapHeight         int     `json:"mapHeight"`
+	CrateDensity      float64 `json:"crateDensity"` // Chance a free tile starts with a crate
+	BombFuseMs        int     `json:"bombFuseMs"`
+	FireDurationMs    int     `json:"fireDurationMs"`
+	BlastRange        int     `json:"blastRange"` // Before flame power-ups
+	StartLives        int     `json:"startLives"`
+	InvulnerabilityMs int     `json:"invulnerabilityMs"` // Protection after losing a life
+	RespawnOnHit      bool    `json:"respawnOnHit"`      // Send hit players back to their spawn corner
+}
+
+// The classic rules
+func DefaultRules() Rules {
+	return Rules{
+		MapWidth:          MAP_WIDTH,
+		MapHeight:         MAP_HEIGHT,
+		CrateDensity:      CRATE_CHANCE,
+		BombFuseMs:        int(BOMB_FUSE.Milliseconds()),
+		FireDurationMs:    int(FIRE_DURATION.Milliseconds()),
+		BlastRange:        BASE_BLAST_RANGE,
+		StartLives:        START_LIVES,
+		InvulnerabilityMs: int(INVULNERABILITY.Milliseconds()),
+	}
+}
+
+func (r Rules) BombFuse() time.Duration {
+	return time.Duration(r.BombFuseMs) * time.Millisecond
+}
+
+func (r Rules) FireDuration() time.Duration {
+	return time.Duration(r.FireDurationMs) * time.Millisecond
+}
+
+func (r Rules) Invulnerability() time.Duration {
+	return time.Duration(r.InvulnerabilityMs) * time.Millisecond
+}
+
+// Spawn positions in the corners
+func (r Rules) spawnPoints() [][]int {
+	return [][]int{
+		{1, 1},                            // Top-left
+		{r.MapWidth - 2, 1},               // Top-right
+		{1, r.MapHeight - 2},              // Bottom-left
+		{r.MapWidth - 2, r.MapHeight - 2}, // Bottom-right
+	}
+}
+
+// Get spawn position for player based on player index
+func (r Rules) SpawnPosition(playerIndex int) (int, int) {
+	spawns := r.spawnPoints()
+	if playerIndex < len(spawns) {
+		return spawns[playerIndex][0], spawns[playerIndex][1]
+	}
+
+	// Fallback to center if more than 4 players
+	return r.MapWidth / 2, r.MapHeight / 2
+}
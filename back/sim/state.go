@@ -0,0 +1,272 @@
+// Package sim implements the multiplayer game rules as a deterministic
+// simulation. It never reads the wall clock, the network or the global
+// random source: time only moves through Step's dt and randomness comes
+// from the seed the state was created with, so the same seed and inputs
+// always play out the same match.
+package sim
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Default rules and fixed rule constants
+const (
+	MAP_WIDTH           = 15
+	MAP_HEIGHT          = 13
+	START_LIVES         = 3
+	BOMB_FUSE           = 3 * time.Second
+	FIRE_DURATION       = 600 * time.Millisecond // How long a blast keeps burning
+	BASE_BLAST_RANGE    = 2
+	CRATE_CHANCE        = 0.6                    // Chance a free tile starts with a crate
+	POWERUP_DROP_CHANCE = 0.3                    // Chance a destroyed crate drops a power-up
+	MAX_POWERUP_LEVEL   = 5                      // Cap for each power-up counter
+	BOMB_SLIDE_INTERVAL = 100 * time.Millisecond // Time for a kicked bomb to cross one tile
+	BASE_MOVE_COOLDOWN  = 200 * time.Millisecond // Delay between moves without speed power-ups
+	MOVE_COOLDOWN_STEP  = 25 * time.Millisecond  // Cooldown removed per speed level
+	MIN_MOVE_COOLDOWN   = 80 * time.Millisecond
+	MOVE_QUEUE_TIMEOUT  = 300 * time.Millisecond // Queued moves older than this are dropped
+	INVULNERABILITY     = 2 * time.Second        // Protection after losing a life
+)
+
+// Score awards
+const (
+	SCORE_CRATE     = 10
+	SCORE_KILL      = 100
+	SCORE_SELF_KILL = -50
+	SCORE_WIN       = 500
+)
+
+// Map tiles
+const (
+	TILE_EMPTY = 0
+	TILE_WALL  = 1
+	TILE_CRATE = 2
+)
+
+// Power-up types that can drop from crates
+var powerUpTypes = []string{"bomb", "flame", "speed", "kick"}
+
+type Player struct {
+	ID                string        `json:"id"`
+	Name              string        `json:"name"`
+	X                 int           `json:"x"`
+	Y                 int           `json:"y"`
+	Lives             int           `json:"lives"`
+	Score             int           `json:"score"`
+	PowerUps          PowerUps      `json:"powerUps"`
+	Stats             PlayerStats   `json:"stats"`
+	EliminatedAt      time.Duration `json:"-"`
+	SpawnX            int           `json:"-"` // Corner the player respawns in
+	SpawnY            int           `json:"-"`
+	InvulnerableUntil time.Duration `json:"-"` // End of the protection after a hit
+	NextMoveAt        time.Duration `json:"-"` // End of the current move cooldown
+	QueuedMove        string        `json:"-"` // Direction received during the move cooldown
+	QueuedAt          time.Duration `json:"-"`
+	Left              bool          `json:"-"` // Left the match before it ended
+}
+
+type PowerUps struct {
+	Bombs  int  `json:"bombs"`
+	Flames int  `json:"flames"`
+	Speed  int  `json:"speed"`
+	Kick   bool `json:"kick"`
+}
+
+type PlayerStats struct {
+	Kills           int `json:"kills"`
+	SelfKills       int `json:"selfKills"`
+	LivesLost       int `json:"livesLost"`
+	CratesDestroyed int `json:"cratesDestroyed"`
+}
+
+type PowerUp struct {
+	ID   string `json:"id"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	Type string `json:"type"` // "bomb", "flame", "speed", "kick"
+}
+
+type Bomb struct {
+	ID          string        `json:"id"`
+	X           int           `json:"x"`
+	Y           int           `json:"y"`
+	PlayerID    string        `json:"playerId"`
+	Timer       int           `json:"timer"`
+	PlacedAt    time.Duration `json:"-"`
+	SlideDX     int           `json:"-"` // Slide direction once kicked
+	SlideDY     int           `json:"-"`
+	NextSlideAt time.Duration `json:"-"`
+}
+
+// Everything the rules need to advance a match. Times are measured on the
+// simulation clock, which starts at zero and only moves through Step.
+type State struct {
+	Seed     int64               `json:"seed"`
+	Rules    Rules               `json:"rules"`
+	Tick     uint64              `json:"tick"`
+	Now      time.Duration       `json:"-"`
+	Map      [][]int             `json:"map"`
+	Players  map[string]*Player  `json:"players"`
+	Bombs    map[string]*Bomb    `json:"bombs"`
+	PowerUps map[string]*PowerUp `json:"powerUps"`
+	Fires    map[[2]int]*Fire    `json:"-"` // See ActiveFires
+	Departed []*Player           `json:"-"` // Players who forfeited, kept for the results
+
+	nextID int
+	rng    *rand.Rand
+}
+
+// Create a match with a map generated from seed
+func NewState(seed int64, rules Rules) *State {
+	rng := rand.New(rand.NewSource(seed))
+	return &State{
+		Seed:     seed,
+		Rules:    rules,
+		Map:      generateMap(rules, rng),
+		Players:  make(map[string]*Player),
+		Bombs:    make(map[string]*Bomb),
+		PowerUps: make(map[string]*PowerUp),
+		Fires:    make(map[[2]int]*Fire),
+		rng:      rng,
+	}
+}
+
+// Add a player at the first spawn point no other player holds
+func (s *State) AddPlayer(id, name string) *Player {
+	x, y := s.Rules.SpawnPosition(s.freeSpawnIndex())
+	player := &Player{
+		ID:     id,
+		Name:   name,
+		X:      x,
+		Y:      y,
+		Lives:  s.Rules.StartLives,
+		SpawnX: x,
+		SpawnY: y,
+	}
+	s.Players[id] = player
+	return player
+}
+
+// Index of the first spawn point left free by players who came and went,
+// or one past the corners once they are all taken
+func (s *State) freeSpawnIndex() int {
+	taken := make(map[[2]int]bool, len(s.Players))
+	for _, player := range s.Players {
+		taken[[2]int{player.SpawnX, player.SpawnY}] = true
+	}
+
+	spawns := s.Rules.spawnPoints()
+	for i, spawn := range spawns {
+		if !taken[[2]int{spawn[0], spawn[1]}] {
+			return i
+		}
+	}
+	return len(spawns)
+}
+
+func (s *State) RemovePlayer(id string) {
+	delete(s.Players, id)
+}
+
+// Take a player out of a running match. It counts as eliminated now, and
+// still gets a result when the match finishes.
+func (s *State) Forfeit(id string) {
+	player, exists := s.Players[id]
+	if !exists {
+		return
+	}
+	if player.Lives > 0 {
+		player.Lives = 0
+		player.EliminatedAt = s.Now
+	}
+	player.Left = true
+	s.Departed = append(s.Departed, player)
+	delete(s.Players, id)
+}
+
+// Number of players with lives left
+func (s *State) AlivePlayers() int {
+	alive := 0
+	for _, player := range s.Players {
+		if player.Lives > 0 {
+			alive++
+		}
+	}
+	return alive
+}
+
+// Player IDs in a stable order, so simultaneous events resolve the same way every time
+func (s *State) sortedPlayerIDs() []string {
+	playerIDs := make([]string, 0, len(s.Players))
+	for playerID := range s.Players {
+		playerIDs = append(playerIDs, playerID)
+	}
+	sort.Strings(playerIDs)
+	return playerIDs
+}
+
+// Next entity ID. IDs come from a counter rather than the clock so replays match.
+func (s *State) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s_%d", prefix, s.nextID)
+}
+
+// Generate a basic bomberman map
+func generateMap(rules Rules, rng *rand.Rand) [][]int {
+	width, height := rules.MapWidth, rules.MapHeight
+	gameMap := make([][]int, height)
+	for i := range gameMap {
+		gameMap[i] = make([]int, width)
+	}
+
+	// Create outer walls
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x == 0 || x == width-1 || y == 0 || y == height-1 {
+				gameMap[y][x] = TILE_WALL
+			}
+		}
+	}
+
+	// Create inner wall pattern (every other cell in grid)
+	for y := 2; y < height-2; y += 2 {
+		for x := 2; x < width-2; x += 2 {
+			gameMap[y][x] = TILE_WALL
+		}
+	}
+
+	// Add random crates, keeping spawn points clear
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			if gameMap[y][x] != TILE_EMPTY || isNearSpawn(rules, x, y) {
+				continue
+			}
+			if rng.Float64() < rules.CrateDensity {
+				gameMap[y][x] = TILE_CRATE
+			}
+		}
+	}
+
+	return gameMap
+}
+
+// Check if position is near spawn points
+func isNearSpawn(rules Rules, x, y int) bool {
+	for _, spawn := range rules.spawnPoints() {
+		if abs(x-spawn[0]) <= 1 && abs(y-spawn[1]) <= 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Absolute value helper
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,50 @@
+package sim
+
+import "testing"
+
+func TestAddPlayerTakesFreeCorner(t *testing.T) {
+	tests := []struct {
+		name         string
+		left         []string // Players who leave before the newcomer joins
+		wantX, wantY int
+	}{
+		{"no one left", nil, 13, 11},
+		{"first player left", []string{"player_1"}, 1, 1},
+		{"second player left", []string{"player_2"}, 13, 1},
+		{"two players left", []string{"player_3", "player_1"}, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewState(1, DefaultRules())
+			for _, playerID := range []string{"player_1", "player_2", "player_3"} {
+				s.AddPlayer(playerID, playerID)
+			}
+			for _, playerID := range tt.left {
+				s.RemovePlayer(playerID)
+			}
+
+			newcomer := s.AddPlayer("player_4", "player_4")
+			if newcomer.X != tt.wantX || newcomer.Y != tt.wantY || newcomer.SpawnX != tt.wantX || newcomer.SpawnY != tt.wantY {
+				t.Errorf("newcomer spawns at (%d, %d), want (%d, %d)", newcomer.X, newcomer.Y, tt.wantX, tt.wantY)
+			}
+			for playerID, player := range s.Players {
+				if playerID != newcomer.ID && player.SpawnX == newcomer.SpawnX && player.SpawnY == newcomer.SpawnY {
+					t.Errorf("newcomer shares %s's corner", playerID)
+				}
+			}
+		})
+	}
+}
+
+func TestAddPlayerPastTheCorners(t *testing.T) {
+	s := NewState(1, DefaultRules())
+	for _, playerID := range []string{"player_1", "player_2", "player_3", "player_4"} {
+		s.AddPlayer(playerID, playerID)
+	}
+
+	extra := s.AddPlayer("player_5", "player_5")
+	if extra.X != MAP_WIDTH/2 || extra.Y != MAP_HEIGHT/2 {
+		t.Errorf("fifth player spawns at (%d, %d), want the center", extra.X, extra.Y)
+	}
+}
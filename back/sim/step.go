@@ -0,0 +1,222 @@
+package sim
+
+import "time"
+
+// A player action fed into Step
+type Input struct {
+	PlayerID  string `json:"playerId"`
+	Type      string `json:"type"`                // "move", "bomb"
+	Direction string `json:"direction,omitempty"` // "up", "down", "left", "right"
+}
+
+// Something that happened during a step, for the caller to broadcast.
+// Type and Data match the WebSocket message of the same name.
+type Event struct {
+	Type string
+	From string
+	Data interface{}
+}
+
+// Apply inputs in order, then advance the simulation by dt. The state is
+// updated in place and returned along with the events it produced. A zero
+// dt applies the inputs without moving the clock or the tick counter.
+func Step(state *State, inputs []Input, dt time.Duration) (*State, []Event) {
+	events := []Event{}
+
+	for _, input := range inputs {
+		events = append(events, state.applyInput(input)...)
+	}
+
+	if dt > 0 {
+		state.Now += dt
+		state.Tick++
+
+		// Apply moves that arrived during a player's cooldown
+		events = append(events, state.applyQueuedMoves()...)
+
+		// Update bombs
+		events = append(events, state.slideBombs()...)
+		events = append(events, state.updateBombs()...)
+
+		// Fire left by explosions
+		state.expireFires()
+		events = append(events, state.burnPlayers()...)
+	}
+
+	return state, events
+}
+
+func (s *State) applyInput(input Input) []Event {
+	player, exists := s.Players[input.PlayerID]
+	if !exists || player.Lives <= 0 {
+		return nil
+	}
+
+	switch input.Type {
+	case "move":
+		return s.handleMove(player, input.Direction)
+	case "bomb":
+		return s.placeBomb(player)
+	}
+	return nil
+}
+
+// Move now if the cooldown allows it, otherwise keep the latest direction
+// for a later tick
+func (s *State) handleMove(player *Player, direction string) []Event {
+	if _, _, ok := directionDelta(direction); !ok {
+		return nil
+	}
+
+	if s.Now < player.NextMoveAt {
+		player.QueuedMove = direction
+		player.QueuedAt = s.Now
+		return nil
+	}
+
+	player.QueuedMove = ""
+	return s.movePlayer(player, direction)
+}
+
+// Apply queued moves once each player's cooldown has elapsed
+func (s *State) applyQueuedMoves() []Event {
+	events := []Event{}
+	for _, playerID := range s.sortedPlayerIDs() {
+		player := s.Players[playerID]
+		if player.QueuedMove == "" {
+			continue
+		}
+
+		// Drop stale or dead players' inputs
+		if player.Lives <= 0 || s.Now-player.QueuedAt > MOVE_QUEUE_TIMEOUT {
+			player.QueuedMove = ""
+			continue
+		}
+
+		if s.Now < player.NextMoveAt {
+			continue
+		}
+
+		direction := player.QueuedMove
+		player.QueuedMove = ""
+		events = append(events, s.movePlayer(player, direction)...)
+	}
+	return events
+}
+
+// Convert a direction name into a grid step
+func directionDelta(direction string) (int, int, bool) {
+	switch direction {
+	case "up":
+		return 0, -1, true
+	case "down":
+		return 0, 1, true
+	case "left":
+		return -1, 0, true
+	case "right":
+		return 1, 0, true
+	}
+	return 0, 0, false
+}
+
+// Minimum delay between two moves, shortened by the speed power-up
+func MoveCooldown(player *Player) time.Duration {
+	cooldown := BASE_MOVE_COOLDOWN - time.Duration(player.PowerUps.Speed)*MOVE_COOLDOWN_STEP
+	if cooldown < MIN_MOVE_COOLDOWN {
+		return MIN_MOVE_COOLDOWN
+	}
+	return cooldown
+}
+
+// Move the player one tile, kicking a bomb in the way if they can
+func (s *State) movePlayer(player *Player, direction string) []Event {
+	dx, dy, ok := directionDelta(direction)
+	if !ok {
+		return nil
+	}
+
+	newX, newY := player.X+dx, player.Y+dy
+
+	// Check bounds and collisions
+	if !s.IsWalkable(newX, newY) {
+		// Walking into a bomb with the kick power-up sends it sliding
+		if player.PowerUps.Kick && s.kickBomb(newX, newY, dx, dy) != nil {
+			player.NextMoveAt = s.Now + MoveCooldown(player)
+		}
+		return nil
+	}
+
+	player.X = newX
+	player.Y = newY
+	player.NextMoveAt = s.Now + MoveCooldown(player)
+
+	events := []Event{{
+		Type: "playerMoved",
+		From: player.ID,
+		Data: &PlayerMoved{PlayerID: player.ID, X: newX, Y: newY},
+	}}
+
+	if powerUp := s.collectPowerUp(player); powerUp != nil {
+		events = append(events, Event{
+			Type: "powerUpCollected",
+			From: player.ID,
+			Data: &PowerUpCollected{
+				PlayerID:  player.ID,
+				PowerUpID: powerUp.ID,
+				Type:      powerUp.Type,
+				PowerUps:  player.PowerUps,
+			},
+		})
+	}
+
+	return events
+}
+
+// Check if a tile can be entered (no walls, crates or bombs, within bounds).
+// Only the target tile is checked, so a player can always step off the
+// bomb they are standing on.
+func (s *State) IsWalkable(x, y int) bool {
+	// Check bounds
+	if x < 0 || y < 0 || y >= len(s.Map) || x >= len(s.Map[0]) {
+		return false
+	}
+
+	// Walls and crates are solid
+	if s.Map[y][x] == TILE_WALL || s.Map[y][x] == TILE_CRATE {
+		return false
+	}
+
+	// Bombs are solid
+	return s.bombAt(x, y) == nil
+}
+
+// Pick up the power-up under the player, if any
+func (s *State) collectPowerUp(player *Player) *PowerUp {
+	for powerUpID, powerUp := range s.PowerUps {
+		if powerUp.X != player.X || powerUp.Y != player.Y {
+			continue
+		}
+
+		switch powerUp.Type {
+		case "bomb":
+			if player.PowerUps.Bombs < MAX_POWERUP_LEVEL {
+				player.PowerUps.Bombs++
+			}
+		case "flame":
+			if player.PowerUps.Flames < MAX_POWERUP_LEVEL {
+				player.PowerUps.Flames++
+			}
+		case "speed":
+			if player.PowerUps.Speed < MAX_POWERUP_LEVEL {
+				player.PowerUps.Speed++
+			}
+		case "kick":
+			player.PowerUps.Kick = true
+		}
+
+		delete(s.PowerUps, powerUpID)
+		return powerUp
+	}
+
+	return nil
+}
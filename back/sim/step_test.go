@@ -0,0 +1,115 @@
+package sim
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Step length used by the tests, one tick at 60 Hz
+const TEST_TICK = time.Second / 60
+
+// A match on an open map: border walls only, no pillars or crates
+func openState(rules Rules) *State {
+	rules.CrateDensity = 0
+	s := NewState(1, rules)
+	for y := 1; y < rules.MapHeight-1; y++ {
+		for x := 1; x < rules.MapWidth-1; x++ {
+			s.Map[y][x] = TILE_EMPTY
+		}
+	}
+	return s
+}
+
+// Add a player standing at (x, y)
+func addPlayerAt(s *State, id string, x, y int) *Player {
+	player := s.AddPlayer(id, id)
+	player.X, player.Y = x, y
+	return player
+}
+
+// Put a bomb down for playerID, as if it was placed at placedAt
+func addBombAt(s *State, playerID string, x, y int, placedAt time.Duration) *Bomb {
+	bomb := &Bomb{
+		ID:       s.newID("bomb"),
+		X:        x,
+		Y:        y,
+		PlayerID: playerID,
+		Timer:    s.Rules.BombFuseMs,
+		PlacedAt: placedAt,
+	}
+	s.Bombs[bomb.ID] = bomb
+	return bomb
+}
+
+// Step with no input until d has passed, collecting the events
+func advance(s *State, d time.Duration) []Event {
+	events := []Event{}
+	for end := s.Now + d; s.Now < end; {
+		_, stepEvents := Step(s, nil, TEST_TICK)
+		events = append(events, stepEvents...)
+	}
+	return events
+}
+
+// Events of one type, in order
+func eventsOfType(events []Event, eventType string) []Event {
+	found := []Event{}
+	for _, event := range events {
+		if event.Type == eventType {
+			found = append(found, event)
+		}
+	}
+	return found
+}
+
+// Play a match with random moves and bombs drawn from inputSeed, returning
+// the final state and every event
+func playMatch(seed, inputSeed int64, ticks int) (*State, []Event) {
+	s := NewState(seed, DefaultRules())
+	playerIDs := []string{"player_1", "player_2", "player_3", "player_4"}
+	for _, playerID := range playerIDs {
+		s.AddPlayer(playerID, playerID)
+	}
+
+	directions := []string{"up", "down", "left", "right"}
+	rng := rand.New(rand.NewSource(inputSeed))
+	events := []Event{}
+	for i := 0; i < ticks; i++ {
+		inputs := []Input{}
+		for _, playerID := range playerIDs {
+			switch n := rng.Intn(20); {
+			case n < 4:
+				inputs = append(inputs, Input{PlayerID: playerID, Type: "move", Direction: directions[n]})
+			case n == 4:
+				inputs = append(inputs, Input{PlayerID: playerID, Type: "bomb"})
+			}
+		}
+		_, stepEvents := Step(s, inputs, TEST_TICK)
+		events = append(events, stepEvents...)
+	}
+	return s, events
+}
+
+func TestStepIsDeterministic(t *testing.T) {
+	const ticks = 60 * 60 // One minute of play
+
+	first, firstEvents := playMatch(42, 7, ticks)
+	second, secondEvents := playMatch(42, 7, ticks)
+
+	if len(eventsOfType(firstEvents, "bombExploded")) == 0 {
+		t.Fatal("no bomb went off, the match does not exercise much")
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Error("same seed and inputs gave different states")
+	}
+	if !reflect.DeepEqual(firstEvents, secondEvents) {
+		t.Error("same seed and inputs gave different events")
+	}
+
+	other, _ := playMatch(43, 7, ticks)
+	if reflect.DeepEqual(first.Map, other.Map) {
+		t.Error("another seed gave the same map")
+	}
+}
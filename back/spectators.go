@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Get an existing room by ID
+func getRoom(roomID string) *GameRoom {
+	roomsMutex.RLock()
+	defer roomsMutex.RUnlock()
+
+	return gameRooms[roomID]
+}
+
+// Attach a read-only client to a room, even if it is full or already playing
+func joinAsSpectator(conn *websocket.Conn, roomID string, mode syncMode) {
+	room := getRoom(roomID)
+	if room == nil {
+		conn.WriteJSON(errorMessage(ERR_ROOM_NOT_FOUND, "Room not found"))
+		conn.Close()
+		return
+	}
+
+	client := newClient(conn, room.ID, fmt.Sprintf("spectator_%d", time.Now().UnixNano()), mode)
+	client.Spectator = true
+
+	joined := room.do(func() {
+		room.Spectators[client.PlayerID] = client
+		log.Printf("Spectator %s joined room %s", client.PlayerID, room.ID)
+
+		client.sendMessage(Message{Type: "welcome", Data: WelcomeData{
+			ProtocolVersion: PROTOCOL_VERSION,
+			SpectatorID:     client.PlayerID,
+			RoomID:          room.ID,
+			Room:            room.Snapshot(),
+			Spectator:       true,
+			TickRate:        config.TickRate,
+			Sync:            mode.sync(),
+			Encoding:        mode.encoding(),
+		}})
+		client.sendMessage(Message{Type: "gameState", Data: gameStateData(room)})
+	})
+	if !joined {
+		conn.WriteJSON(errorMessage(ERR_ROOM_NOT_FOUND, "Room not found"))
+		conn.Close()
+		return
+	}
+
+	go client.writePump()
+	go client.readPump(room)
+}
+
+// Spectators can only ping and resync; gameplay input and chat are refused.
+// Must run on the room goroutine.
+func handleSpectatorMessage(room *GameRoom, client *Client, msgType string) {
+	switch msgType {
+	case "ping":
+		client.sendMessage(Message{Type: "pong"})
+	case "resync":
+		resync(room, client)
+	default:
+		client.sendMessage(Message{Type: "error", Data: ErrorData{
+			Code:    ERR_FORBIDDEN,
+			Message: "Spectators can only ping and resync",
+			Type:    msgType,
+		}})
+	}
+}
+
+// Detach a spectator whose connection closed. Must run on the room goroutine.
+func removeSpectator(room *GameRoom, client *Client) {
+	delete(room.Spectators, client.PlayerID)
+
+	log.Printf("Spectator %s left room %s", client.PlayerID, room.ID)
+}
+
+// Disconnect every spectator of a room that is going away. Must run on the room goroutine.
+func closeSpectators(room *GameRoom) {
+	for _, client := range room.Spectators {
+		client.Conn.Close()
+	}
+}
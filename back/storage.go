@@ -0,0 +1,405 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Stockage des scores, choisi au démarrage
+type ScoreStore interface {
+	All() ([]scoreToSend, error)
+	Query(query ScoreQuery) ([]scoreToSend, int, error)
+	Add(entries ...scoreToSend) error
+	Rank(score int) (int, error) // Position d'un score, 1 = meilleur
+	Close() error
+}
+
+// Ouvrir le stockage demandé ("json" ou "sqlite")
+func openScoreStore(kind, jsonPath, sqlitePath string) (ScoreStore, error) {
+	switch kind {
+	case "json":
+		return newJSONScoreStore(jsonPath), nil
+	case "sqlite":
+		return newSQLiteScoreStore(sqlitePath, jsonPath)
+	}
+	return nil, fmt.Errorf("unknown score store %q", kind)
+}
+
+// ---- Stockage dans un fichier JSON ----
+
+type jsonScoreStore struct {
+	path   string
+	scores []scoreToSend
+	mutex  sync.Mutex
+}
+
+func newJSONScoreStore(path string) *jsonScoreStore {
+	scores := loadScoresFromFile(path)
+	for i := range scores {
+		scores[i].DurationMs = scoreTimeMs(scores[i].Time)
+	}
+
+	return &jsonScoreStore{
+		path:   path,
+		scores: scores,
+	}
+}
+
+func (s *jsonScoreStore) All() ([]scoreToSend, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	scores := make([]scoreToSend, len(s.scores))
+	copy(scores, s.scores)
+	return scores, nil
+}
+
+func (s *jsonScoreStore) Query(query ScoreQuery) ([]scoreToSend, int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	scores, total := applyScoreQuery(s.scores, query)
+	return scores, total, nil
+}
+
+func (s *jsonScoreStore) Add(entries ...scoreToSend) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, entry := range entries {
+		s.scores = append(s.scores, normalizeScore(entry))
+	}
+	return saveScoresToFile(s.path, s.scores)
+}
+
+func (s *jsonScoreStore) Rank(score int) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rank := 1
+	for _, entry := range s.scores {
+		if entry.Score > score {
+			rank++
+		}
+	}
+	return rank, nil
+}
+
+func (s *jsonScoreStore) Close() error {
+	return nil
+}
+
+// Compléter la date et la durée d'un nouveau score
+func normalizeScore(entry scoreToSend) scoreToSend {
+	if entry.Date.IsZero() {
+		entry.Date = time.Now().UTC().Truncate(time.Second)
+	}
+	entry.DurationMs = scoreTimeMs(entry.Time)
+	return entry
+}
+
+// Écrire les scores dans un fichier temporaire puis le renommer,
+// pour ne jamais laisser un fichier à moitié écrit
+func saveScoresToFile(filename string, scores []scoreToSend) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".scores-*.json")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// Encoder et écrire les scores
+	if err := json.NewEncoder(tmp).Encode(scores); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encoding scores: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing scores: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+func loadScoresFromFile(filename string) []scoreToSend {
+	var existingScores []scoreToSend
+
+	// Ouvrir le fichier s'il existe
+	file, err := os.Open(filename)
+	if err != nil {
+		// Si le fichier n'existe pas, retourner une liste vide
+		fmt.Println("No existing scores found, starting fresh.")
+		return existingScores
+	}
+	defer file.Close()
+
+	// Décoder les scores depuis le fichier
+	decoder := json.NewDecoder(file)
+	err = decoder.Decode(&existingScores)
+	if err != nil {
+		fmt.Println("Error decoding scores from file:", err)
+	}
+
+	return existingScores
+}
+
+// ---- Stockage SQLite (pur Go, sans cgo) ----
+
+type sqliteScoreStore struct {
+	db *sql.DB
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS scores (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	name       TEXT    NOT NULL,
+	score      INTEGER NOT NULL,
+	time       TEXT    NOT NULL DEFAULT '',
+	mode       TEXT    NOT NULL DEFAULT '',
+	placement  INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_scores_score ON scores(score DESC);
+CREATE INDEX IF NOT EXISTS idx_scores_name ON scores(name);
+CREATE INDEX IF NOT EXISTS idx_scores_created_at ON scores(created_at);
+`
+
+func newSQLiteScoreStore(path, jsonPath string) (*sqliteScoreStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("opening sqlite database: %w", err)
+	}
+
+	// Une seule connexion : SQLite sérialise de toute façon les écritures
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating schema: %w", err)
+	}
+
+	store := &sqliteScoreStore{db: db}
+	if err := store.migrateSchema(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := store.migrateFromJSON(jsonPath); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Ajouter la colonne time_ms (durée en millisecondes) aux bases existantes
+func (s *sqliteScoreStore) migrateSchema() error {
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info('scores')`)
+	if err != nil {
+		return fmt.Errorf("reading schema: %w", err)
+	}
+	hasTimeMs := false
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return err
+		}
+		if column == "time_ms" {
+			hasTimeMs = true
+		}
+	}
+	rows.Close()
+
+	if !hasTimeMs {
+		if _, err := s.db.Exec(`ALTER TABLE scores ADD COLUMN time_ms INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return fmt.Errorf("adding time_ms column: %w", err)
+		}
+		if err := s.backfillTimeMs(); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.db.Exec(`CREATE INDEX IF NOT EXISTS idx_scores_time_ms ON scores(time_ms)`)
+	return err
+}
+
+// Calculer time_ms pour les scores enregistrés avant la colonne
+func (s *sqliteScoreStore) backfillTimeMs() error {
+	rows, err := s.db.Query(`SELECT id, time FROM scores`)
+	if err != nil {
+		return err
+	}
+	durations := map[int64]int64{}
+	for rows.Next() {
+		var id int64
+		var raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return err
+		}
+		durations[id] = scoreTimeMs(raw)
+	}
+	rows.Close()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for id, ms := range durations {
+		if _, err := tx.Exec(`UPDATE scores SET time_ms = ? WHERE id = ?`, ms, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Importer l'ancien fichier JSON si la base est encore vide
+func (s *sqliteScoreStore) migrateFromJSON(jsonPath string) error {
+	var count int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM scores`).Scan(&count); err != nil {
+		return fmt.Errorf("counting scores: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	scores := loadScoresFromFile(jsonPath)
+	if len(scores) == 0 {
+		return nil
+	}
+
+	if err := s.Add(scores...); err != nil {
+		return fmt.Errorf("migrating %s: %w", jsonPath, err)
+	}
+	fmt.Printf("Migrated %d scores from %s\n", len(scores), jsonPath)
+	return nil
+}
+
+const sqliteScoreColumns = `name, score, time, time_ms, mode, placement, created_at`
+
+func (s *sqliteScoreStore) All() ([]scoreToSend, error) {
+	return s.selectScores(`SELECT ` + sqliteScoreColumns + ` FROM scores ORDER BY id`)
+}
+
+func (s *sqliteScoreStore) Query(query ScoreQuery) ([]scoreToSend, int, error) {
+	where := []string{}
+	args := []interface{}{}
+	if query.ExactName != "" {
+		where = append(where, `name = ?`)
+		args = append(args, query.ExactName)
+	}
+	if query.Name != "" {
+		where = append(where, `name LIKE ? ESCAPE '\' COLLATE NOCASE`)
+		args = append(args, "%"+escapeLike(query.Name)+"%")
+	}
+	if !query.From.IsZero() {
+		where = append(where, `created_at >= ?`)
+		args = append(args, query.From.UTC().Format(scoreDateLayout))
+	}
+	if !query.To.IsZero() {
+		where = append(where, `created_at <= ?`)
+		args = append(args, query.To.UTC().Format(scoreDateLayout))
+	}
+	clause := ""
+	if len(where) > 0 {
+		clause = ` WHERE ` + strings.Join(where, ` AND `)
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM scores`+clause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// Même ordre que applyScoreQuery : critère demandé, puis score, puis date
+	order := `score DESC`
+	if query.SortBy == "time" {
+		order = `time_ms ` + sqlDirection(query.Order) + `, score DESC`
+	} else if query.Order == "asc" {
+		order = `score ASC`
+	}
+	sqlQuery := `SELECT ` + sqliteScoreColumns + ` FROM scores` + clause + ` ORDER BY ` + order + `, created_at, id`
+	if query.Limit > 0 || query.Offset > 0 {
+		// LIMIT -1 : pas de limite, seulement le décalage
+		limit := query.Limit
+		if limit == 0 {
+			limit = -1
+		}
+		sqlQuery += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, query.Offset)
+	}
+
+	scores, err := s.selectScores(sqlQuery, args...)
+	return scores, total, err
+}
+
+func (s *sqliteScoreStore) selectScores(sqlQuery string, args ...interface{}) ([]scoreToSend, error) {
+	rows, err := s.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := []scoreToSend{}
+	for rows.Next() {
+		var entry scoreToSend
+		if err := rows.Scan(&entry.Name, &entry.Score, &entry.Time, &entry.DurationMs, &entry.Mode, &entry.Placement, &entry.Date); err != nil {
+			return nil, err
+		}
+		scores = append(scores, entry)
+	}
+	return scores, rows.Err()
+}
+
+func sqlDirection(order string) string {
+	if order == "asc" {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// Échapper les jokers de LIKE dans une recherche par nom
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (s *sqliteScoreStore) Add(entries ...scoreToSend) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO scores (name, score, time, time_ms, mode, placement, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		entry = normalizeScore(entry)
+		if _, err := stmt.Exec(entry.Name, entry.Score, entry.Time, entry.DurationMs, entry.Mode, entry.Placement, entry.Date.UTC().Format(scoreDateLayout)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteScoreStore) Rank(score int) (int, error) {
+	var better int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM scores WHERE score > ?`, score).Scan(&better); err != nil {
+		return 0, err
+	}
+	return better + 1, nil
+}
+
+func (s *sqliteScoreStore) Close() error {
+	return s.db.Close()
+}
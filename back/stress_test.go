@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Stress run defaults. A longer run is opt-in, for example:
+// go test -race -run TestStress -stress.clients 100 -stress.duration 10s
+const (
+	STRESS_CLIENTS        = 20
+	STRESS_DURATION       = 2 * time.Second
+	STRESS_SHORT_CLIENTS  = 5 // With -short
+	STRESS_SHORT_DURATION = 500 * time.Millisecond
+	STRESS_MAX_SESSION    = 3 * time.Second // Longest a simulated connection stays open
+	STRESS_STALL_BUFFER   = 1024            // Socket receive buffer of clients that stop reading
+)
+
+var (
+	stressClients  = flag.Int("stress.clients", STRESS_CLIENTS, "simulated clients connected at once in TestStress")
+	stressDuration = flag.Duration("stress.duration", STRESS_DURATION, "how long TestStress clients keep reconnecting")
+	stressSeed     = flag.Int64("stress.seed", 0, "random seed for TestStress, 0 for a new one")
+	stressVerbose  = flag.Bool("stress.v", false, "show the server log in TestStress")
+)
+
+// What the simulated clients saw
+type stressStats struct {
+	sessions   atomic.Int64
+	reconnects atomic.Int64
+	messages   atomic.Int64
+	frames     atomic.Int64 // Binary sync frames
+	errors     atomic.Int64 // Error replies, some provoked on purpose
+	dropped    atomic.Int64 // Connections the server closed first
+	unknown    atomic.Int64 // Messages whose type is not in the protocol
+	requests   atomic.Int64 // REST calls
+}
+
+// Run the server against simulated clients that join, play, chat,
+// spectate, stall, drop and reconnect at random, then shut it down as on
+// SIGTERM and check that every room was left consistent. Run it with -race
+// so the race detector watches the server.
+func TestStress(t *testing.T) {
+	clients, duration := *stressClients, *stressDuration
+	if testing.Short() {
+		clients, duration = STRESS_SHORT_CLIENTS, STRESS_SHORT_DURATION
+	}
+	seed := *stressSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	useTestServer(t)
+
+	server := httptest.NewServer(newRouter())
+	defer server.Close()
+
+	t.Logf("Stressing with %d clients for %s (seed %d)", clients, duration, seed)
+
+	stats := &stressStats{}
+	deadline := time.Now().Add(duration)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed + int64(i)))
+			for time.Now().Before(deadline) {
+				stressSession(rng, server.URL, fmt.Sprintf("stress%d", i), stats)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Matches still running are drained, then ended at the shutdown deadline
+	shutdownRooms(nil)
+
+	t.Logf("Sessions: %d (%d reconnects, %d dropped by the server)", stats.sessions.Load(), stats.reconnects.Load(), stats.dropped.Load())
+	t.Logf("Received: %d messages, %d binary frames, %d errors", stats.messages.Load(), stats.frames.Load(), stats.errors.Load())
+	t.Logf("REST requests: %d", stats.requests.Load())
+
+	if unknown := stats.unknown.Load(); unknown > 0 {
+		t.Errorf("%d messages outside the protocol", unknown)
+	}
+	checkRooms(t)
+}
+
+// Give the server short timings, so matches start, end and expire players
+// within a test, and scratch storage. Everything is put back afterwards,
+// shutdown state included.
+func useTestServer(t *testing.T) {
+	savedConfig, savedStore := config, scoreStore
+	dir := t.TempDir()
+
+	config = defaultConfig()
+	config.ScoresFile = filepath.Join(dir, "scores.json")
+	config.ScoresDBFile = filepath.Join(dir, "scores.db")
+	config.ReplaysDir = filepath.Join(dir, "replays")
+	config.Waiting = Duration(300 * time.Millisecond)
+	config.Countdown = Duration(MIN_COUNTDOWN)
+	config.ReconnectGrace = Duration(time.Second)
+	config.PlayerTimeout = Duration(2 * time.Second)
+	config.RoomCleanupInterval = Duration(time.Second)
+	config.FinishedRoomTimeout = Duration(time.Second)
+	config.ShutdownTimeout = Duration(2 * time.Second)
+	config.SlowClientTimeout = Duration(time.Second)
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	scoreStore = newJSONScoreStore(config.ScoresFile)
+
+	if !*stressVerbose {
+		log.SetOutput(io.Discard)
+	}
+
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		scoreStore.Close()
+		config, scoreStore = savedConfig, savedStore
+
+		roomsMutex.Lock()
+		gameRooms = make(map[string]*GameRoom)
+		roomsMutex.Unlock()
+		shuttingDown.Store(false)
+		shutdownNow = make(chan struct{})
+	})
+}
+
+// One simulated client: a REST call, a spectator, or a player who may come
+// back on their session token once the connection ends
+func stressSession(rng *rand.Rand, baseURL, name string, stats *stressStats) {
+	switch rng.Intn(10) {
+	case 0:
+		stressRequest(rng, baseURL, stats)
+		return
+	case 1:
+		if roomID := randomRoomID(rng, baseURL, stats); roomID != "" {
+			stressConnect(rng, baseURL, "spectate=1&room="+roomID+randomSyncQuery(rng), stats)
+		}
+		return
+	}
+
+	query := "name=" + name + randomSyncQuery(rng)
+	if rng.Intn(4) == 0 {
+		if roomID := randomRoomID(rng, baseURL, stats); roomID != "" {
+			query += "&room=" + roomID
+		}
+	}
+
+	token := stressConnect(rng, baseURL, query, stats)
+	for token != "" && rng.Intn(3) == 0 {
+		stats.reconnects.Add(1)
+		token = stressConnect(rng, baseURL, "token="+token+randomSyncQuery(rng), stats)
+	}
+}
+
+// Connect, send a random mix of valid and invalid messages for a while, then
+// leave cleanly or drop the connection. Some clients stop reading to play a
+// slow consumer. Returns the session token from the welcome message.
+func stressConnect(rng *rand.Rand, baseURL, query string, stats *stressStats) string {
+	length := time.Duration(rng.Int63n(int64(STRESS_MAX_SESSION)))
+	stall := rng.Intn(10) == 0
+
+	// A staller shrinks its socket buffer so the server's queue backs up
+	// instead of the kernel's
+	dialer := *websocket.DefaultDialer
+	if stall {
+		length = STRESS_MAX_SESSION
+		dialer.NetDial = func(network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, addr)
+			if tcp, ok := conn.(*net.TCPConn); ok {
+				tcp.SetReadBuffer(STRESS_STALL_BUFFER)
+			}
+			return conn, err
+		}
+	}
+
+	url := "ws" + strings.TrimPrefix(baseURL, "http") + "/ws?protocol=" + strconv.Itoa(PROTOCOL_VERSION) + "&" + query
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		return ""
+	}
+	stats.sessions.Add(1)
+
+	token := make(chan string, 1)
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		if stall {
+			time.Sleep(length)
+		}
+		stressRead(conn, token, stats)
+	}()
+
+	interval := time.Duration(10+rng.Intn(50)) * time.Millisecond
+	if stall {
+		interval = 0
+	}
+
+	seq := 0
+	end := time.Now().Add(length)
+	for time.Now().Before(end) {
+		select {
+		case <-readDone:
+			end = time.Now()
+			continue
+		case <-time.After(interval):
+		}
+
+		// A staller keeps asking for the full state it is not reading
+		message := randomClientMessage(rng, &seq)
+		if stall {
+			message = []byte(`{"type":"resync"}`)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			break
+		}
+	}
+
+	select {
+	case <-readDone:
+		stats.dropped.Add(1)
+	default:
+		if rng.Intn(2) == 0 {
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		}
+	}
+	conn.Close()
+	<-readDone
+
+	select {
+	case sessionToken := <-token:
+		return sessionToken
+	default:
+		return ""
+	}
+}
+
+// Read until the connection ends, checking every message against the protocol
+func stressRead(conn *websocket.Conn, token chan<- string, stats *stressStats) {
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		stats.messages.Add(1)
+		if messageType == websocket.BinaryMessage {
+			stats.frames.Add(1)
+			continue
+		}
+
+		var msg struct {
+			Type string `json:"type"`
+			Data struct {
+				SessionToken string `json:"sessionToken"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			stats.unknown.Add(1)
+			continue
+		}
+		if _, known := serverMessages[msg.Type]; !known {
+			stats.unknown.Add(1)
+		}
+
+		switch msg.Type {
+		case "error":
+			stats.errors.Add(1)
+		case "welcome":
+			if msg.Data.SessionToken != "" {
+				token <- msg.Data.SessionToken
+			}
+		}
+	}
+}
+
+// Mostly gameplay input, with chat, pings, resyncs, replayed sequence
+// numbers and garbage mixed in
+func randomClientMessage(rng *rand.Rand, seq *int) []byte {
+	directions := []string{"up", "down", "left", "right"}
+
+	switch n := rng.Intn(20); {
+	case n < 12:
+		*seq++
+		return []byte(fmt.Sprintf(`{"type":"playerInput","data":{"type":"move","direction":"%s","sequenceNumber":%d}}`, directions[rng.Intn(len(directions))], *seq))
+	case n < 14:
+		*seq++
+		return []byte(fmt.Sprintf(`{"type":"playerInput","data":{"type":"bomb","sequenceNumber":%d}}`, *seq))
+	case n < 15:
+		return []byte(fmt.Sprintf(`{"type":"playerInput","data":{"type":"bomb","sequenceNumber":%d}}`, *seq))
+	case n < 16:
+		return []byte(`{"type":"chat","data":{"message":"hello"}}`)
+	case n < 17:
+		return []byte(`{"type":"ping"}`)
+	case n < 18:
+		return []byte(`{"type":"resync"}`)
+	case n < 19:
+		return []byte(`{"type":"teleport"}`)
+	default:
+		return []byte(`{"type":`)
+	}
+}
+
+// Nothing, delta sync, or binary delta sync
+func randomSyncQuery(rng *rand.Rand) string {
+	switch rng.Intn(3) {
+	case 1:
+		return "&sync=delta"
+	case 2:
+		return "&sync=delta&encoding=binary"
+	}
+	return ""
+}
+
+// List rooms, create one, or add a bot to one
+func stressRequest(rng *rand.Rand, baseURL string, stats *stressStats) {
+	var resp *http.Response
+	var err error
+
+	switch rng.Intn(3) {
+	case 0:
+		resp, err = http.Get(baseURL + "/rooms")
+	case 1:
+		resp, err = http.Post(baseURL+"/rooms", "application/json", strings.NewReader(`{"name":"stress"}`))
+	default:
+		roomID := randomRoomID(rng, baseURL, stats)
+		if roomID == "" {
+			return
+		}
+		resp, err = http.Post(baseURL+"/rooms/"+roomID+"/bots", "application/json", strings.NewReader(`{"count":1}`))
+	}
+
+	stats.requests.Add(1)
+	if err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// ID of a random room from GET /rooms, or "" if there is none
+func randomRoomID(rng *rand.Rand, baseURL string, stats *stressStats) string {
+	resp, err := http.Get(baseURL + "/rooms")
+	stats.requests.Add(1)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	var rooms []RoomResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rooms); err != nil || len(rooms) == 0 {
+		return ""
+	}
+	return rooms[rng.Intn(len(rooms))].ID
+}
+
+// Check the rooms left after shutdown. Their goroutines have stopped, so
+// their state can be read from here.
+func checkRooms(t *testing.T) {
+	for _, room := range allRooms() {
+		select {
+		case <-room.done:
+		default:
+			t.Errorf("room %s: goroutine still running", room.ID)
+			continue
+		}
+
+		if len(room.Players) > room.MaxPlayers {
+			t.Errorf("room %s: %d players for %d slots", room.ID, len(room.Players), room.MaxPlayers)
+		}
+		if len(room.Players) != len(room.Sim.Players) {
+			t.Errorf("room %s: %d players but %d in the simulation", room.ID, len(room.Players), len(room.Sim.Players))
+		}
+		for playerID, player := range room.Players {
+			if room.Sim.Players[playerID] != player.Player {
+				t.Errorf("room %s: player %s is not the one in the simulation", room.ID, playerID)
+			}
+		}
+		for playerID, client := range room.Clients {
+			if _, exists := room.Players[playerID]; !exists || client.PlayerID != playerID {
+				t.Errorf("room %s: client %s has no player", room.ID, playerID)
+			}
+		}
+		for botID := range room.Bots {
+			if _, exists := room.Players[botID]; !exists {
+				t.Errorf("room %s: bot %s has no player", room.ID, botID)
+			}
+		}
+	}
+}
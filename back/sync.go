@@ -0,0 +1,479 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"bomberman-multiplayer/sim"
+)
+
+// Time between two keyframes sent to every delta client
+const SYNC_KEYFRAME_INTERVAL = 3 * time.Second
+
+// Events whose whole effect is already in the entity changes of a delta
+var syncedEvents = map[string]bool{
+	"playerMoved":      true,
+	"bombMoved":        true,
+	"bombPlaced":       true,
+	"powerUpSpawned":   true,
+	"powerUpDestroyed": true,
+}
+
+// State sync for clients that asked for deltas instead of one message per
+// event. Each room tick sends the tiles and entities that changed since the
+// previous frame, numbered so a client that misses one can ask for a
+// keyframe. Entity changes carry the full entity, so applying a delta on a
+// newer state is harmless.
+type StateSync struct {
+	Seq          uint64 // Number of the last frame sent
+	lastKeyframe time.Time
+	tiles        [][]int // What clients were last told
+	players      map[string]PlayerState
+	bombs        map[string]BombState
+	powerUps     map[string]sim.PowerUp
+	events       []Message // Events since the last frame
+}
+
+// A full state or the changes since the previous frame
+type SyncFrame struct {
+	Seq             uint64           `json:"seq"`
+	Tick            uint64           `json:"tick"`
+	Keyframe        bool             `json:"keyframe,omitempty"`
+	State           string           `json:"state,omitempty"` // Keyframes only
+	Map             [][]int          `json:"map,omitempty"`   // Keyframes only
+	Fires           []sim.ActiveFire `json:"fires,omitempty"` // Keyframes only
+	Tiles           []TileChange     `json:"tiles,omitempty"` // Deltas only
+	Players         []PlayerState    `json:"players,omitempty"`
+	RemovedPlayers  []string         `json:"removedPlayers,omitempty"`
+	Bombs           []BombState      `json:"bombs,omitempty"`
+	RemovedBombs    []string         `json:"removedBombs,omitempty"`
+	PowerUps        []sim.PowerUp    `json:"powerUps,omitempty"`
+	RemovedPowerUps []string         `json:"removedPowerUps,omitempty"`
+	Events          []Message        `json:"events,omitempty"`
+}
+
+type TileChange struct {
+	X    int `json:"x"`
+	Y    int `json:"y"`
+	Tile int `json:"tile"`
+}
+
+// What a client needs to draw a player. The name is only sent in keyframes
+// and when the player first appears.
+type PlayerState struct {
+	ID           string       `json:"id"`
+	Name         string       `json:"name,omitempty"`
+	X            int          `json:"x"`
+	Y            int          `json:"y"`
+	Lives        int          `json:"lives"`
+	Score        int          `json:"score"`
+	PowerUps     sim.PowerUps `json:"powerUps"`
+	Disconnected bool         `json:"disconnected"`
+}
+
+type BombState struct {
+	ID       string `json:"id"`
+	PlayerID string `json:"playerId"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+}
+
+// How a client wants game state delivered, from the sync and encoding
+// query parameters of its connection
+type syncMode struct {
+	delta  bool
+	binary bool
+}
+
+func parseSyncMode(sync, encoding string) (syncMode, error) {
+	mode := syncMode{}
+	switch sync {
+	case "", "events":
+	case "delta":
+		mode.delta = true
+	default:
+		return mode, fmt.Errorf("sync must be events or delta")
+	}
+
+	switch encoding {
+	case "", "json":
+	case "binary":
+		if !mode.delta {
+			return mode, fmt.Errorf("binary encoding needs sync=delta")
+		}
+		mode.binary = true
+	default:
+		return mode, fmt.Errorf("encoding must be json or binary")
+	}
+	return mode, nil
+}
+
+func (m syncMode) sync() string {
+	if m.delta {
+		return "delta"
+	}
+	return "events"
+}
+
+func (m syncMode) encoding() string {
+	if m.binary {
+		return "binary"
+	}
+	return "json"
+}
+
+func newStateSync() *StateSync {
+	return &StateSync{
+		players:  make(map[string]PlayerState),
+		bombs:    make(map[string]BombState),
+		powerUps: make(map[string]sim.PowerUp),
+	}
+}
+
+// Queue simulation events for the next frame, leaving out those the entity
+// changes already cover. Must run on the room goroutine.
+func (s *StateSync) record(events []sim.Event) {
+	for _, event := range events {
+		if syncedEvents[event.Type] {
+			continue
+		}
+
+		data := event.Data
+		// Explosions carry the whole map and players for event clients
+		if exploded, ok := data.(*sim.BombExploded); ok {
+			light := *exploded
+			light.Map = nil
+			light.Players = nil
+			data = &light
+		}
+		s.events = append(s.events, Message{Type: event.Type, Data: data, From: event.From})
+	}
+}
+
+// Changes since the previous frame, or nil if nothing changed. Moves the
+// baseline to the current state. Must run on the room goroutine.
+func (s *StateSync) delta(room *GameRoom) *SyncFrame {
+	frame := &SyncFrame{Tick: room.Sim.Tick, Events: s.events}
+	s.events = nil
+
+	// Tiles
+	if s.tiles == nil {
+		s.tiles = make([][]int, len(room.Sim.Map))
+		for y, row := range room.Sim.Map {
+			s.tiles[y] = append([]int(nil), row...)
+		}
+	}
+	for y, row := range room.Sim.Map {
+		for x, tile := range row {
+			if s.tiles[y][x] != tile {
+				s.tiles[y][x] = tile
+				frame.Tiles = append(frame.Tiles, TileChange{X: x, Y: y, Tile: tile})
+			}
+		}
+	}
+
+	// Players
+	for _, playerID := range sortedPlayerIDs(room) {
+		state := playerState(room.Players[playerID])
+		last, known := s.players[playerID]
+		if known && last == state {
+			continue
+		}
+		s.players[playerID] = state
+		if known {
+			state.Name = ""
+		}
+		frame.Players = append(frame.Players, state)
+	}
+	for playerID := range s.players {
+		if _, exists := room.Players[playerID]; !exists {
+			delete(s.players, playerID)
+			frame.RemovedPlayers = append(frame.RemovedPlayers, playerID)
+		}
+	}
+
+	// Bombs
+	for _, bomb := range room.Sim.Bombs {
+		state := BombState{ID: bomb.ID, PlayerID: bomb.PlayerID, X: bomb.X, Y: bomb.Y}
+		if s.bombs[bomb.ID] != state {
+			s.bombs[bomb.ID] = state
+			frame.Bombs = append(frame.Bombs, state)
+		}
+	}
+	for bombID := range s.bombs {
+		if _, exists := room.Sim.Bombs[bombID]; !exists {
+			delete(s.bombs, bombID)
+			frame.RemovedBombs = append(frame.RemovedBombs, bombID)
+		}
+	}
+
+	// Power-ups never move, they only appear and go away
+	for _, powerUp := range room.Sim.PowerUps {
+		if _, known := s.powerUps[powerUp.ID]; !known {
+			s.powerUps[powerUp.ID] = *powerUp
+			frame.PowerUps = append(frame.PowerUps, *powerUp)
+		}
+	}
+	for powerUpID := range s.powerUps {
+		if _, exists := room.Sim.PowerUps[powerUpID]; !exists {
+			delete(s.powerUps, powerUpID)
+			frame.RemovedPowerUps = append(frame.RemovedPowerUps, powerUpID)
+		}
+	}
+
+	if len(frame.Tiles)+len(frame.Players)+len(frame.RemovedPlayers)+len(frame.Bombs)+len(frame.RemovedBombs)+
+		len(frame.PowerUps)+len(frame.RemovedPowerUps)+len(frame.Events) == 0 {
+		return nil
+	}
+	frame.sort()
+	return frame
+}
+
+// The whole state as of the last frame, with that frame's events. Must run
+// on the room goroutine, right after taking a delta.
+func (s *StateSync) keyframe(room *GameRoom, events []Message) *SyncFrame {
+	frame := &SyncFrame{
+		Seq:      s.Seq,
+		Tick:     room.Sim.Tick,
+		Keyframe: true,
+		State:    room.State,
+		Map:      s.tiles,
+		Fires:    room.Sim.ActiveFires(),
+		Events:   events,
+	}
+	for _, state := range s.players {
+		frame.Players = append(frame.Players, state)
+	}
+	for _, state := range s.bombs {
+		frame.Bombs = append(frame.Bombs, state)
+	}
+	for _, powerUp := range s.powerUps {
+		frame.PowerUps = append(frame.PowerUps, powerUp)
+	}
+	frame.sort()
+	return frame
+}
+
+// Stable entity order, so the same state always encodes the same way
+func (f *SyncFrame) sort() {
+	sort.Slice(f.Players, func(i, j int) bool { return f.Players[i].ID < f.Players[j].ID })
+	sort.Slice(f.Bombs, func(i, j int) bool { return f.Bombs[i].ID < f.Bombs[j].ID })
+	sort.Slice(f.PowerUps, func(i, j int) bool { return f.PowerUps[i].ID < f.PowerUps[j].ID })
+	sort.Strings(f.RemovedPlayers)
+	sort.Strings(f.RemovedBombs)
+	sort.Strings(f.RemovedPowerUps)
+}
+
+func playerState(player *Player) PlayerState {
+	return PlayerState{
+		ID:           player.ID,
+		Name:         player.Name,
+		X:            player.X,
+		Y:            player.Y,
+		Lives:        player.Lives,
+		Score:        player.Score,
+		PowerUps:     player.PowerUps,
+		Disconnected: player.Disconnected,
+	}
+}
+
+// Send this tick's delta to the delta clients, and a keyframe to those who
+// just joined, asked for one, or are due their periodic one. A lagging
+// client skips frames and gets a keyframe once it catches up; the gap in
+// numbers lets it ask for one sooner. Must run on the room goroutine.
+func flushSync(room *GameRoom, now time.Time) {
+	sync := room.Sync
+	events := sync.events
+	delta := sync.delta(room)
+	if delta != nil {
+		sync.Seq++
+		delta.Seq = sync.Seq
+	}
+
+	periodic := now.Sub(sync.lastKeyframe) >= SYNC_KEYFRAME_INTERVAL
+	if periodic {
+		sync.lastKeyframe = now
+	}
+
+	var keyframe *SyncFrame
+	encoded := map[bool][]byte{} // By binary flag
+	encodedKeyframe := map[bool][]byte{}
+
+	for _, client := range syncClients(room) {
+		if client.needKeyframe || periodic {
+			if keyframe == nil {
+				keyframe = sync.keyframe(room, events)
+			}
+			client.needKeyframe = !client.queue(keyframe, "keyframe", encodedKeyframe)
+			continue
+		}
+		if delta != nil {
+			client.queue(delta, "stateDelta", encoded)
+		}
+	}
+}
+
+// Clients and spectators that asked for deltas. Must run on the room goroutine.
+func syncClients(room *GameRoom) []*Client {
+	clients := []*Client{}
+	for _, client := range room.Clients {
+		if client.Delta {
+			clients = append(clients, client)
+		}
+	}
+	for _, client := range room.Spectators {
+		if client.Delta {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// Queue a frame in the client's encoding without blocking, reusing the
+// encoding of an earlier client. Returns false if the client skipped it.
+func (c *Client) queue(frame *SyncFrame, msgType string, encoded map[bool][]byte) bool {
+	data, done := encoded[c.Binary]
+	if !done {
+		if c.Binary {
+			data = encodeSyncFrame(frame)
+		} else {
+			var err error
+			data, err = json.Marshal(Message{Type: msgType, Data: frame})
+			if err != nil {
+				log.Printf("Error marshaling %s: %v", msgType, err)
+				return true
+			}
+		}
+		encoded[c.Binary] = data
+	}
+
+	return c.enqueue(outgoing{data: data, binary: c.Binary}, true)
+}
+
+// Binary encoding of a frame, sent as a WebSocket binary message:
+//
+//	frame    = kind:u8 seq:uvarint tick:uvarint body
+//	kind     = 1 delta | 2 keyframe
+//	keyframe = state:string height:uvarint width:uvarint tiles:u8*(width*height) fires:list(fire) entities
+//	delta    = tiles:list(x:uvarint y:uvarint tile:u8) entities
+//	entities = players:list(player) removedPlayers:list(string)
+//	           bombs:list(bomb) removedBombs:list(string)
+//	           powerUps:list(powerUp) removedPowerUps:list(string)
+//	           events:list(type:string from:string data:string)
+//	player   = id:string name:string x:varint y:varint lives:varint score:varint
+//	           bombs:u8 flames:u8 speed:u8 flags:u8 (1 kick, 2 disconnected)
+//	bomb     = id:string playerId:string x:varint y:varint
+//	powerUp  = id:string type:string x:varint y:varint
+//	fire     = x:varint y:varint playerId:string remainingMs:varint
+//	list(T)  = count:uvarint T*
+//	string   = length:uvarint utf8 bytes
+//
+// Event data is the event's JSON, as in stateDelta messages.
+func encodeSyncFrame(frame *SyncFrame) []byte {
+	buf := make([]byte, 0, 256)
+	putString := func(s string) {
+		buf = binary.AppendUvarint(buf, uint64(len(s)))
+		buf = append(buf, s...)
+	}
+	putInt := func(n int) {
+		buf = binary.AppendVarint(buf, int64(n))
+	}
+	putStrings := func(list []string) {
+		buf = binary.AppendUvarint(buf, uint64(len(list)))
+		for _, s := range list {
+			putString(s)
+		}
+	}
+
+	if frame.Keyframe {
+		buf = append(buf, 2)
+	} else {
+		buf = append(buf, 1)
+	}
+	buf = binary.AppendUvarint(buf, frame.Seq)
+	buf = binary.AppendUvarint(buf, frame.Tick)
+
+	if frame.Keyframe {
+		putString(frame.State)
+		width := 0
+		if len(frame.Map) > 0 {
+			width = len(frame.Map[0])
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(frame.Map)))
+		buf = binary.AppendUvarint(buf, uint64(width))
+		for _, row := range frame.Map {
+			for _, tile := range row {
+				buf = append(buf, byte(tile))
+			}
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(frame.Fires)))
+		for _, fire := range frame.Fires {
+			putInt(fire.X)
+			putInt(fire.Y)
+			putString(fire.PlayerID)
+			putInt(int(fire.RemainingMs))
+		}
+	} else {
+		buf = binary.AppendUvarint(buf, uint64(len(frame.Tiles)))
+		for _, tile := range frame.Tiles {
+			buf = binary.AppendUvarint(buf, uint64(tile.X))
+			buf = binary.AppendUvarint(buf, uint64(tile.Y))
+			buf = append(buf, byte(tile.Tile))
+		}
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(frame.Players)))
+	for _, player := range frame.Players {
+		putString(player.ID)
+		putString(player.Name)
+		putInt(player.X)
+		putInt(player.Y)
+		putInt(player.Lives)
+		putInt(player.Score)
+		flags := byte(0)
+		if player.PowerUps.Kick {
+			flags |= 1
+		}
+		if player.Disconnected {
+			flags |= 2
+		}
+		buf = append(buf, byte(player.PowerUps.Bombs), byte(player.PowerUps.Flames), byte(player.PowerUps.Speed), flags)
+	}
+	putStrings(frame.RemovedPlayers)
+
+	buf = binary.AppendUvarint(buf, uint64(len(frame.Bombs)))
+	for _, bomb := range frame.Bombs {
+		putString(bomb.ID)
+		putString(bomb.PlayerID)
+		putInt(bomb.X)
+		putInt(bomb.Y)
+	}
+	putStrings(frame.RemovedBombs)
+
+	buf = binary.AppendUvarint(buf, uint64(len(frame.PowerUps)))
+	for _, powerUp := range frame.PowerUps {
+		putString(powerUp.ID)
+		putString(powerUp.Type)
+		putInt(powerUp.X)
+		putInt(powerUp.Y)
+	}
+	putStrings(frame.RemovedPowerUps)
+
+	buf = binary.AppendUvarint(buf, uint64(len(frame.Events)))
+	for _, event := range frame.Events {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			log.Printf("Error marshaling %s event: %v", event.Type, err)
+			data = []byte("null")
+		}
+		putString(event.Type)
+		putString(event.From)
+		putString(string(data))
+	}
+
+	return buf
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Bornes d'un score soumis par un client
+const (
+	MIN_NAME_LENGTH = 1
+	MAX_NAME_LENGTH = 20
+	MAX_SCORE       = 1000000
+	MAX_SCORE_TIME  = 2 * time.Hour
+	MAX_SCORE_BODY  = 4 << 10 // 4 Ko
+)
+
+// Lettres (accents compris), chiffres, espace, tiret et underscore
+var validNamePattern = regexp.MustCompile(`^[\p{L}\p{N} _-]+$`)
+
+// Réponse d'erreur de l'API, avec un message par champ invalide
+type apiError struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Envoyer une erreur au format JSON
+func writeJSONError(w http.ResponseWriter, status int, message string, fields map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiError{Error: message, Fields: fields})
+}
+
+// Nettoyer un pseudo avant de l'enregistrer : renvoie le pseudo sans
+// espaces autour, ou la raison de son refus
+func validateName(input string) (string, string) {
+	name := strings.TrimSpace(input)
+	switch length := utf8.RuneCountInString(name); {
+	case length == 0:
+		return "", "is required"
+	case length < MIN_NAME_LENGTH || length > MAX_NAME_LENGTH:
+		return "", fmt.Sprintf("must be between %d and %d characters", MIN_NAME_LENGTH, MAX_NAME_LENGTH)
+	case !validNamePattern.MatchString(name):
+		return "", "may only contain letters, digits, spaces, '-' and '_'"
+	}
+	return name, ""
+}
+
+// Vérifier un score soumis et renvoyer l'entrée nettoyée,
+// ou les erreurs par champ
+func validateScore(input scoreToGet) (scoreToSend, map[string]string) {
+	fields := map[string]string{}
+
+	name, problem := validateName(input.Name)
+	if problem != "" {
+		fields["name"] = problem
+	}
+
+	if input.Score < 0 || input.Score > MAX_SCORE {
+		fields["score"] = fmt.Sprintf("must be between 0 and %d", MAX_SCORE)
+	}
+
+	timeValue := strings.TrimSpace(input.Time)
+	duration, err := parseScoreTime(timeValue)
+	switch {
+	case timeValue == "":
+		fields["time"] = "is required"
+	case err != nil:
+		fields["time"] = "must be a duration such as 1:30"
+	case duration > MAX_SCORE_TIME:
+		fields["time"] = fmt.Sprintf("must not exceed %s", MAX_SCORE_TIME)
+	}
+
+	if len(fields) > 0 {
+		return scoreToSend{}, fields
+	}
+
+	return scoreToSend{
+		Name:  name,
+		Score: input.Score,
+		Time:  timeValue,
+	}, nil
+}
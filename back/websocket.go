@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"bomberman-multiplayer/sim"
 )
 
 // WebSocket handler
@@ -17,82 +20,283 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
-	defer conn.Close()
 
-	// Get player name and room ID from query parameters
+	// Get player name, room ID and session token from query parameters
 	playerName := r.URL.Query().Get("name")
 	roomID := r.URL.Query().Get("room")
-	
+	token := r.URL.Query().Get("token")
+
+	// Clients that announce a protocol version must speak ours
+	if version := r.URL.Query().Get("protocol"); version != "" && version != strconv.Itoa(PROTOCOL_VERSION) {
+		conn.WriteJSON(errorMessage(ERR_UNSUPPORTED_PROTOCOL, fmt.Sprintf("Protocol version %s is not supported, the server speaks %d", version, PROTOCOL_VERSION)))
+		conn.Close()
+		return
+	}
+
+	// How game state is delivered: one message per event, or sync frames
+	mode, err := parseSyncMode(r.URL.Query().Get("sync"), r.URL.Query().Get("encoding"))
+	if err != nil {
+		conn.WriteJSON(errorMessage(ERR_UNSUPPORTED_SYNC, err.Error()))
+		conn.Close()
+		return
+	}
+
+	// Play back a stored match
+	if replayID := r.URL.Query().Get("replay"); replayID != "" {
+		streamReplay(conn, replayID, r.URL.Query().Get("speed"))
+		return
+	}
+
+	// Watch a room without taking a player slot
+	if r.URL.Query().Get("spectate") == "1" {
+		joinAsSpectator(conn, roomID, mode)
+		return
+	}
+
+	// Reclaim a player whose connection dropped during a match
+	if token != "" {
+		if room, player := findSession(token); room != nil && resumeSession(conn, room, player, mode) {
+			return
+		}
+	}
+
 	if playerName == "" {
 		log.Printf("Player name is required")
-		conn.WriteJSON(Message{Type: "error", Data: "Player name is required"})
+		conn.WriteJSON(errorMessage(ERR_NAME_REQUIRED, "Player name is required"))
+		conn.Close()
+		return
+	}
+
+	if shuttingDown.Load() {
+		conn.WriteJSON(errorMessage(ERR_SHUTTING_DOWN, "Server is shutting down"))
+		conn.Close()
 		return
 	}
 
 	// Create or join room
 	room := getOrCreateRoom(roomID)
 	if room == nil {
-		conn.WriteJSON(Message{Type: "error", Data: "Room is full"})
+		conn.WriteJSON(errorMessage(ERR_ROOM_FULL, "Room is full"))
+		conn.Close()
 		return
 	}
 
 	// Create client
-	client := &Client{
-		Conn:   conn,
-		RoomID: room.ID,
-		Send:   make(chan []byte, 256),
-	}
+	client := newClient(conn, room.ID, "", mode)
+
+	// Add player to room, register the client and greet it in one go on
+	// the room goroutine, so no broadcast can slip in before the welcome
+	var player *Player
+	room.do(func() {
+		player = addPlayerToRoom(room, client, playerName)
+		if player == nil {
+			return
+		}
+
+		client.PlayerID = player.ID
+		room.Clients[client.PlayerID] = client
+
+		log.Printf("Player %s (%s) joined room %s", playerName, player.ID, room.ID)
+
+		// Send welcome message
+		welcomeData := WelcomeData{
+			ProtocolVersion:  PROTOCOL_VERSION,
+			PlayerID:         player.ID,
+			RoomID:           room.ID,
+			Room:             room.Snapshot(),
+			SessionToken:     player.SessionToken,
+			ReconnectGraceMs: time.Duration(config.ReconnectGrace).Milliseconds(),
+			TickRate:         config.TickRate,
+			Sync:             mode.sync(),
+			Encoding:         mode.encoding(),
+		}
+		client.sendMessage(Message{Type: "welcome", Data: welcomeData})
+
+		// Notify other players
+		broadcastToRoom(room, Message{
+			Type: "playerJoined",
+			Data: player,
+			From: player.ID,
+		}, client.PlayerID)
 
-	// Add player to room
-	player := addPlayerToRoom(room, client, playerName)
+		// Send current game state
+		client.sendMessage(Message{Type: "gameState", Data: gameStateData(room)})
+	})
 	if player == nil {
-		conn.WriteJSON(Message{Type: "error", Data: "Cannot join room"})
+		conn.WriteJSON(errorMessage(ERR_JOIN_FAILED, "Cannot join room"))
+		conn.Close()
 		return
 	}
 
-	client.PlayerID = player.ID
+	// Start goroutines for reading and writing
+	go client.writePump()
+	go client.readPump(room)
+}
 
-	// Register client
-	room.mutex.Lock()
-	room.Clients[client.PlayerID] = client
-	room.mutex.Unlock()
+// A client for a new connection. Delta clients start with a keyframe.
+func newClient(conn *websocket.Conn, roomID, playerID string, mode syncMode) *Client {
+	return &Client{
+		Conn:         conn,
+		PlayerID:     playerID,
+		RoomID:       roomID,
+		Send:         make(chan outgoing, SEND_QUEUE_SIZE),
+		Delta:        mode.delta,
+		Binary:       mode.binary,
+		needKeyframe: mode.delta,
+	}
+}
 
-	log.Printf("Player %s (%s) joined room %s", playerName, player.ID, room.ID)
+// Snapshot of the room sent to joining and reconnecting clients. Must run
+// on the room goroutine.
+func gameStateData(room *GameRoom) GameStateData {
+	return GameStateData{
+		Players:    room.Players,
+		Bombs:      room.Sim.Bombs,
+		PowerUps:   room.Sim.PowerUps,
+		Map:        room.Sim.Map,
+		Explosions: room.Sim.ActiveFires(),
+		State:      room.State,
+		Tick:       room.Sim.Tick,
+	}
+}
 
-	// Send welcome message
-	welcomeData := map[string]interface{}{
-		"playerId": player.ID,
-		"roomId":   room.ID,
-		"room":     room,
+// Find the room and player a session token belongs to, if it can still be resumed
+func findSession(token string) (*GameRoom, *Player) {
+	now := time.Now()
+	for _, room := range allRooms() {
+		var found *Player
+		room.do(func() {
+			if room.State == "finished" {
+				return
+			}
+			for _, player := range room.Players {
+				if player.SessionToken != token {
+					continue
+				}
+				if !player.Disconnected || now.Sub(player.DisconnectedAt) <= time.Duration(config.ReconnectGrace) {
+					found = player
+				}
+				return
+			}
+		})
+		if found != nil {
+			return room, found
+		}
 	}
-	client.sendMessage(Message{Type: "welcome", Data: welcomeData})
 
-	// Notify other players
-	broadcastToRoom(room, Message{
-		Type: "playerJoined",
-		Data: player,
-		From: player.ID,
-	}, client.PlayerID)
-
-	// Send current game state
-	gameState := map[string]interface{}{
-		"players": room.Players,
-		"bombs":   room.Bombs,
-		"map":     room.Map,
-		"state":   room.State,
+	return nil, nil
+}
+
+// Attach a reconnecting client to their existing player and resync them.
+// Returns false if the player left the room since it was found.
+func resumeSession(conn *websocket.Conn, room *GameRoom, player *Player, mode syncMode) bool {
+	client := newClient(conn, room.ID, player.ID, mode)
+
+	resumed := false
+	room.do(func() {
+		if room.Players[player.ID] != player {
+			return
+		}
+		resumed = true
+
+		previous := room.Clients[player.ID]
+		room.Clients[player.ID] = client
+		player.Disconnected = false
+		player.DisconnectedAt = time.Time{}
+		player.LastSeen = time.Now()
+		resetInputs(player)
+
+		// A stale connection that has not noticed the drop yet is replaced
+		if previous != nil {
+			previous.Conn.Close()
+		}
+
+		log.Printf("Player %s (%s) reconnected to room %s", player.Name, player.ID, room.ID)
+
+		welcomeData := WelcomeData{
+			ProtocolVersion:  PROTOCOL_VERSION,
+			PlayerID:         player.ID,
+			RoomID:           room.ID,
+			Room:             room.Snapshot(),
+			SessionToken:     player.SessionToken,
+			ReconnectGraceMs: time.Duration(config.ReconnectGrace).Milliseconds(),
+			Resumed:          true,
+			TickRate:         config.TickRate,
+			Sync:             mode.sync(),
+			Encoding:         mode.encoding(),
+		}
+		client.sendMessage(Message{Type: "welcome", Data: welcomeData})
+
+		if shuttingDown.Load() {
+			client.sendMessage(serverShutdownMessage())
+		}
+
+		broadcastToRoom(room, Message{
+			Type: "playerReconnected",
+			Data: PlayerRef{PlayerID: player.ID},
+			From: player.ID,
+		}, player.ID)
+
+		// Full resync of the match in progress
+		client.sendMessage(Message{Type: "gameState", Data: gameStateData(room)})
+	})
+	if !resumed {
+		return false
 	}
-	client.sendMessage(Message{Type: "gameState", Data: gameState})
 
-	// Start goroutines for reading and writing
 	go client.writePump()
 	go client.readPump(room)
+	return true
 }
 
-// Read messages from the client
+// Handle a closed connection: keep the player for a grace period during a
+// match so they can reconnect, otherwise remove them straight away. Must run
+// on the room goroutine.
+func handleClientDisconnect(room *GameRoom, client *Client) {
+	if client.Spectator {
+		removeSpectator(room, client)
+		return
+	}
+
+	// The player already reconnected on another connection
+	if room.Clients[client.PlayerID] != client {
+		return
+	}
+
+	player, exists := room.Players[client.PlayerID]
+	if !exists || (room.State != "countdown" && room.State != "playing") {
+		removePlayerFromRoom(room, client.PlayerID)
+		return
+	}
+
+	delete(room.Clients, client.PlayerID)
+	player.Disconnected = true
+	player.DisconnectedAt = time.Now()
+
+	log.Printf("Player %s disconnected from room %s, holding slot for %s", client.PlayerID, room.ID, config.ReconnectGrace)
+
+	broadcastToRoom(room, Message{
+		Type: "playerDisconnected",
+		Data: PlayerDisconnectedData{
+			PlayerID: client.PlayerID,
+			GraceMs:  time.Duration(config.ReconnectGrace).Milliseconds(),
+		},
+	}, "")
+}
+
+// Read messages from the client and hand them to the room goroutine
 func (c *Client) readPump(room *GameRoom) {
 	defer func() {
-		removePlayerFromRoom(room, c.PlayerID)
-		close(c.Send)
+		// Only the room goroutine sends on Send, so it also closes it, once
+		// the client is out of the room, to stop writePump. A room that is
+		// gone sends nothing more, so Send can be closed here.
+		closed := room.do(func() {
+			handleClientDisconnect(room, c)
+			close(c.Send)
+		})
+		if !closed {
+			close(c.Send)
+		}
 	}()
 
 	c.Conn.SetReadLimit(512)
@@ -103,8 +307,7 @@ func (c *Client) readPump(room *GameRoom) {
 	})
 
 	for {
-		var msg Message
-		err := c.Conn.ReadJSON(&msg)
+		_, raw, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -112,8 +315,19 @@ func (c *Client) readPump(room *GameRoom) {
 			break
 		}
 
+		// Refuse anything that does not match the protocol
+		msgType, data, errData := decodeClientMessage(raw)
+		if errData != nil {
+			room.post(func() { c.sendMessage(Message{Type: "error", Data: errData}) })
+			continue
+		}
+
 		// Handle different message types
-		handleClientMessage(room, c, msg)
+		if c.Spectator {
+			room.post(func() { handleSpectatorMessage(room, c, msgType) })
+			continue
+		}
+		room.post(func() { handleClientMessage(room, c, msgType, data) })
 	}
 }
 
@@ -134,7 +348,11 @@ func (c *Client) writePump() {
 				return
 			}
 
-			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			messageType := websocket.TextMessage
+			if message.binary {
+				messageType = websocket.BinaryMessage
+			}
+			if err := c.Conn.WriteMessage(messageType, message.data); err != nil {
 				log.Printf("WebSocket write error: %v", err)
 				return
 			}
@@ -148,27 +366,28 @@ func (c *Client) writePump() {
 	}
 }
 
-// Send message to client
+// Send message to client. Must run on the room goroutine.
 func (c *Client) sendMessage(msg Message) {
-	data, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Error marshaling message: %v", err)
-		return
+	if data, ok := marshalMessage(msg); ok {
+		c.enqueue(outgoing{data: data}, coalescedMessages[msg.Type])
 	}
+}
 
-	select {
-	case c.Send <- data:
-	default:
-		close(c.Send)
+// Encode a server message, checking it against the protocol
+func marshalMessage(msg Message) ([]byte, bool) {
+	checkServerMessage(msg)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling %s message: %v", msg.Type, err)
+		return nil, false
 	}
+	return data, true
 }
 
-// Handle different types of client messages
-func handleClientMessage(room *GameRoom, client *Client, msg Message) {
-	room.mutex.Lock()
+// Handle a decoded client message; data is the payload registered for
+// msgType. Must run on the room goroutine.
+func handleClientMessage(room *GameRoom, client *Client, msgType string, data interface{}) {
 	player, exists := room.Players[client.PlayerID]
-	room.mutex.Unlock()
-
 	if !exists {
 		return
 	}
@@ -176,44 +395,30 @@ func handleClientMessage(room *GameRoom, client *Client, msg Message) {
 	// Update player last seen
 	player.LastSeen = time.Now()
 
-	switch msg.Type {
+	switch msgType {
 	case "chat":
-		handleChatMessage(room, client, msg)
+		handleChatMessage(room, client, data.(*ChatInput))
 	case "playerInput":
-		handlePlayerInput(room, client, msg)
+		handlePlayerInput(room, client, data.(*PlayerInput))
 	case "ping":
 		client.sendMessage(Message{Type: "pong"})
+	case "resync":
+		resync(room, client)
 	}
 }
 
-// Handle chat messages
-func handleChatMessage(room *GameRoom, client *Client, msg Message) {
-	room.mutex.RLock()
+// Handle chat messages. Must run on the room goroutine.
+func handleChatMessage(room *GameRoom, client *Client, chat *ChatInput) {
 	player, exists := room.Players[client.PlayerID]
-	room.mutex.RUnlock()
-
 	if !exists {
 		return
 	}
 
-	// Parse chat data
-	var chatData map[string]interface{}
-	if data, ok := msg.Data.(map[string]interface{}); ok {
-		chatData = data
-	} else {
-		return
-	}
-
-	message, ok := chatData["message"].(string)
-	if !ok || message == "" {
-		return
-	}
-
 	// Create chat message
 	chatMsg := ChatMessage{
 		PlayerID:   player.ID,
 		PlayerName: player.Name,
-		Message:    message,
+		Message:    chat.Message,
 		Timestamp:  time.Now(),
 	}
 
@@ -225,168 +430,63 @@ func handleChatMessage(room *GameRoom, client *Client, msg Message) {
 	}, "")
 }
 
-// Handle player input (movement, bombs)
-func handlePlayerInput(room *GameRoom, client *Client, msg Message) {
+// Handle player input (movement, bombs). Must run on the room goroutine.
+func handlePlayerInput(room *GameRoom, client *Client, inputData *PlayerInput) {
+	// The room tick applies it with the other players' inputs
 	if room.State != "playing" {
 		return
 	}
-
-	room.mutex.Lock()
-	player, exists := room.Players[client.PlayerID]
-	room.mutex.Unlock()
-
-	if !exists || player.Lives <= 0 {
-		return
-	}
-
-	// Parse input data
-	var inputData PlayerInput
-	if data, ok := msg.Data.(map[string]interface{}); ok {
-		if inputType, ok := data["type"].(string); ok {
-			inputData.Type = inputType
-		}
-		if direction, ok := data["direction"].(string); ok {
-			inputData.Direction = direction
-		}
-		if x, ok := data["x"].(float64); ok {
-			inputData.X = int(x)
-		}
-		if y, ok := data["y"].(float64); ok {
-			inputData.Y = int(y)
-		}
-	} else {
-		return
-	}
-
-	switch inputData.Type {
-	case "move":
-		handlePlayerMovement(room, player, inputData)
-	case "bomb":
-		handlePlayerBomb(room, player, inputData)
+	if errData := bufferInput(room, client.PlayerID, *inputData); errData != nil {
+		client.sendMessage(Message{Type: "error", Data: errData})
 	}
 }
 
-// Handle player movement
-func handlePlayerMovement(room *GameRoom, player *Player, input PlayerInput) {
-	newX, newY := player.X, player.Y
-
-	switch input.Direction {
-	case "up":
-		newY--
-	case "down":
-		newY++
-	case "left":
-		newX--
-	case "right":
-		newX++
-	default:
+// Send a client the full state: a keyframe on the next tick for delta
+// clients, a gameState message straight away for the others. Must run on
+// the room goroutine.
+func resync(room *GameRoom, client *Client) {
+	if client.Delta {
+		client.needKeyframe = true
 		return
 	}
-
-	// Check bounds and collisions
-	if isValidMove(room, newX, newY) {
-		room.mutex.Lock()
-		player.X = newX
-		player.Y = newY
-		room.mutex.Unlock()
-
-		// Broadcast movement to all players
-		moveData := map[string]interface{}{
-			"playerId": player.ID,
-			"x":        newX,
-			"y":        newY,
-		}
-		broadcastToRoom(room, Message{
-			Type: "playerMoved",
-			Data: moveData,
-			From: player.ID,
-		}, "")
-	}
+	client.sendMessage(Message{Type: "gameState", Data: gameStateData(room)})
 }
 
-// Handle player placing bomb
-func handlePlayerBomb(room *GameRoom, player *Player, input PlayerInput) {
-	room.mutex.Lock()
-	defer room.mutex.Unlock()
-
-	// Check if player can place bomb
-	playerBombs := 0
-	for _, bomb := range room.Bombs {
-		if bomb.PlayerID == player.ID {
-			playerBombs++
-		}
-	}
-
-	maxBombs := 1 + player.PowerUps.Bombs
-	if playerBombs >= maxBombs {
-		return
-	}
-
-	// Check if there's already a bomb at player position
-	for _, bomb := range room.Bombs {
-		if bomb.X == player.X && bomb.Y == player.Y {
-			return
-		}
+// Broadcast simulation events to the room. Delta clients get them in their
+// next sync frame instead. Must run on the room goroutine.
+func broadcastEvents(room *GameRoom, events []sim.Event) {
+	for _, event := range events {
+		sendToRoom(room, Message{
+			Type: event.Type,
+			Data: event.Data,
+			From: event.From,
+		}, func(client *Client) bool { return !client.Delta })
 	}
-
-	// Create bomb
-	bombID := fmt.Sprintf("bomb_%s_%d", player.ID, time.Now().UnixNano())
-	bomb := &Bomb{
-		ID:       bombID,
-		X:        player.X,
-		Y:        player.Y,
-		PlayerID: player.ID,
-		Timer:    3000, // 3 seconds
-		Created:  time.Now(),
-	}
-
-	room.Bombs[bombID] = bomb
-
-	// Broadcast bomb placement
-	broadcastToRoom(room, Message{
-		Type: "bombPlaced",
-		Data: bomb,
-		From: player.ID,
-	}, "")
 }
 
-// Check if a move is valid (no walls, within bounds)
-func isValidMove(room *GameRoom, x, y int) bool {
-	// Check bounds
-	if x < 0 || y < 0 || y >= len(room.Map) || x >= len(room.Map[0]) {
-		return false
-	}
-
-	// Check for walls (assuming 1 = wall, 0 = empty)
-	if room.Map[y][x] == 1 {
-		return false
-	}
-
-	return true
+// Broadcast message to all players in room except exclude. Must run on the
+// room goroutine.
+func broadcastToRoom(room *GameRoom, msg Message, exclude string) {
+	sendToRoom(room, msg, func(client *Client) bool { return client.PlayerID != exclude })
 }
 
-// Broadcast message to all players in room except exclude
-func broadcastToRoom(room *GameRoom, msg Message, exclude string) {
-	data, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("Error marshaling broadcast message: %v", err)
+// Send a message to the room's players and spectators accepted by filter.
+// Sends never block: the room goroutine must not wait on a slow client.
+// Must run on the room goroutine.
+func sendToRoom(room *GameRoom, msg Message, filter func(*Client) bool) {
+	data, ok := marshalMessage(msg)
+	if !ok {
 		return
 	}
+	room.Recorder.RecordEvent(msg.Type, data)
+	coalesce := coalescedMessages[msg.Type]
 
-	room.mutex.RLock()
-	clients := make([]*Client, 0, len(room.Clients))
-	for clientID, client := range room.Clients {
-		if clientID != exclude {
-			clients = append(clients, client)
-		}
-	}
-	room.mutex.RUnlock()
-
-	for _, client := range clients {
-		select {
-		case client.Send <- data:
-		default:
-			close(client.Send)
+	for _, clients := range []map[string]*Client{room.Clients, room.Spectators} {
+		for _, client := range clients {
+			if !filter(client) {
+				continue
+			}
+			client.enqueue(outgoing{data: data}, coalesce)
 		}
 	}
 }
\ No newline at end of file
@@ -66,6 +66,10 @@ export default class MultiplayerBombermanApp extends Component {
 
         this.wsClient.on('disconnected', (data) => {
             console.log('Disconnected from server:', data.reason);
+            // 1013: the server dropped us for falling behind, we reconnect
+            if (data.code === 1013) {
+                this.stateManager.addSystemChatMessage(`Disconnected: ${data.reason}`);
+            }
             this.stateManager.dispatch({
                 type: 'CONNECTION_STATE_CHANGE',
                 payload: 'disconnected'
@@ -126,6 +130,13 @@ export default class MultiplayerBombermanApp extends Component {
             });
         });
 
+        this.wsClient.on('inputAck', (message) => {
+            this.stateManager.dispatch({
+                type: 'INPUT_ACK',
+                payload: message.data
+            });
+        });
+
         this.wsClient.on('bombPlaced', (message) => {
             this.stateManager.dispatch({
                 type: 'BOMB_PLACED',
@@ -140,6 +151,13 @@ export default class MultiplayerBombermanApp extends Component {
             });
         });
 
+        this.wsClient.on('playerHit', (message) => {
+            this.stateManager.dispatch({
+                type: 'PLAYER_HIT',
+                payload: message.data
+            });
+        });
+
         this.wsClient.on('countdown', (message) => {
             this.stateManager.dispatch({
                 type: 'UPDATE_COUNTDOWN',
@@ -176,6 +194,21 @@ export default class MultiplayerBombermanApp extends Component {
                 payload: message.data
             });
         });
+
+        // Messages the server refused, or why it turned us away. Refused
+        // inputs are only logged by WebSocketClient, so they can't flood the chat
+        this.wsClient.on('serverError', (error) => {
+            if (error.type === 'playerInput') {
+                return;
+            }
+            this.stateManager.addSystemChatMessage(`Server error: ${error.message}`);
+        });
+
+        // The server is queueing messages faster than we read them
+        this.wsClient.on('lagWarning', (message) => {
+            const seconds = Math.round(message.data.evictAfterMs / 1000);
+            this.stateManager.addSystemChatMessage(`Connection too slow, disconnecting in ${seconds}s unless it catches up`);
+        });
     }
 
     setupStateSubscriptions() {
@@ -190,6 +223,13 @@ export default class MultiplayerBombermanApp extends Component {
             } else if (gameState === 'menu') {
                 this.setState({ currentView: 'nickname' });
             }
+
+            // The game loop sends all player input, only during a match
+            if (gameState === 'playing' && !this.gameLoop.isRunning) {
+                this.gameLoop.start();
+            } else if (gameState !== 'playing' && this.gameLoop.isRunning) {
+                this.gameLoop.stop();
+            }
             
             this.update();
         });
@@ -402,7 +442,6 @@ export default class MultiplayerBombermanApp extends Component {
             this.gameComponent = new GameComponent({
                 players: this.stateManager.getState('players'),
                 gameState: this.stateManager.getState('gameState'),
-                onPlayerInput: (input) => this.wsClient.sendPlayerInput(input),
                 onToggleChat: () => this.stateManager.dispatch({ type: 'TOGGLE_CHAT' })
             });
         }
@@ -308,31 +308,12 @@ export default class MultiplayerGameLoop {
         const localPlayer = this.stateManager.getLocalPlayer();
         if (!localPlayer) return;
         
-        // Check power-up collisions
-        this.checkPowerUpCollisions(localPlayer);
+        // Power-ups are picked up by the server when the move lands on them
         
         // Check explosion damage (for immediate visual feedback)
         this.checkExplosionCollisions(localPlayer);
     }
 
-    checkPowerUpCollisions(player) {
-        const powerUps = this.stateManager.getState('powerUps') || {};
-        const playerTileX = Math.round(player.x);
-        const playerTileY = Math.round(player.y);
-        
-        Object.values(powerUps).forEach(powerUp => {
-            if (powerUp.x === playerTileX && powerUp.y === playerTileY) {
-                // Send power-up collection to server
-                this.wsClient.sendPlayerInput({
-                    type: 'collectPowerUp',
-                    powerUpId: powerUp.id,
-                    x: powerUp.x,
-                    y: powerUp.y
-                });
-            }
-        });
-    }
-
     checkExplosionCollisions(player) {
         const explosions = this.stateManager.getState('explosions') || [];
         const playerTileX = Math.round(player.x);
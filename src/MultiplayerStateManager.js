@@ -106,6 +106,10 @@ export default class MultiplayerStateManager extends StateManager {
                 this.handlePlayerInputPrediction(action.payload);
                 break;
 
+            case 'INPUT_ACK':
+                this.handleInputAck(action.payload);
+                break;
+
             // Game world actions
             case 'GAME_STATE_UPDATE':
                 this.handleGameStateUpdate(action.payload);
@@ -119,6 +123,10 @@ export default class MultiplayerStateManager extends StateManager {
                 this.handleBombExploded(action.payload);
                 break;
 
+            case 'PLAYER_HIT':
+                this.handlePlayerHit(action.payload);
+                break;
+
             case 'MAP_UPDATE':
                 this.setState('gameMap', action.payload);
                 break;
@@ -270,28 +278,17 @@ export default class MultiplayerStateManager extends StateManager {
         const localPlayer = players[localPlayerId];
         
         if (localPlayer && input.type === 'move') {
-            let newX = localPlayer.x;
-            let newY = localPlayer.y;
-
-            switch (input.direction) {
-                case 'up': newY--; break;
-                case 'down': newY++; break;
-                case 'left': newX--; break;
-                case 'right': newX++; break;
-            }
-
-            // Validate move (basic bounds checking)
-            const gameMap = this.getState('gameMap');
-            if (this.isValidMove(gameMap, newX, newY)) {
-                localPlayer.x = newX;
-                localPlayer.y = newY;
+            const next = this.predictMove(localPlayer, input.direction);
+            if (next) {
+                localPlayer.x = next.x;
+                localPlayer.y = next.y;
                 this.setState('players', players);
                 
                 // Update positions
                 this.handlePlayerMoved({
                     playerId: localPlayerId,
-                    x: newX,
-                    y: newY,
+                    x: next.x,
+                    y: next.y,
                     timestamp: Date.now()
                 });
             }
@@ -304,6 +301,48 @@ export default class MultiplayerStateManager extends StateManager {
         }
     }
 
+    // Position after a move, or null if the move is blocked
+    predictMove({ x, y }, direction) {
+        switch (direction) {
+            case 'up': y--; break;
+            case 'down': y++; break;
+            case 'left': x--; break;
+            case 'right': x++; break;
+        }
+
+        // Validate move (basic bounds checking)
+        return this.isValidMove(this.getState('gameMap'), x, y) ? { x, y } : null;
+    }
+
+    // The server applied our inputs up to seq and put us at (x, y): replay
+    // the inputs it has not seen yet on top of that position
+    handleInputAck({ seq, tick, x, y }) {
+        this.setState('serverTick', tick);
+
+        for (const sequenceNumber of this.localPredictions.keys()) {
+            if (sequenceNumber <= seq) {
+                this.localPredictions.delete(sequenceNumber);
+            }
+        }
+
+        const localPlayerId = this.getState('localPlayerId');
+        const localPlayer = this.getState('players')[localPlayerId];
+        if (!this.serverReconciliation || !localPlayer) return;
+
+        let position = { x, y };
+        const pending = [...this.localPredictions.keys()].sort((a, b) => a - b);
+        pending.forEach(sequenceNumber => {
+            const { input } = this.localPredictions.get(sequenceNumber);
+            if (input.type === 'move') {
+                position = this.predictMove(position, input.direction) || position;
+            }
+        });
+
+        if (localPlayer.x !== position.x || localPlayer.y !== position.y) {
+            this.handlePlayerMoved({ playerId: localPlayerId, ...position });
+        }
+    }
+
     // Server reconciliation for position corrections
     reconcileServerUpdate(serverData) {
         if (!this.serverReconciliation) return;
@@ -357,6 +396,15 @@ export default class MultiplayerStateManager extends StateManager {
         if (gameData.map) {
             this.setState('gameMap', gameData.map);
         }
+
+        // Fire still burning when we joined
+        if (gameData.explosions && gameData.explosions.length > 0) {
+            this.setState('explosions', gameData.explosions.map(fire => [fire.x, fire.y]));
+            const remaining = Math.max(...gameData.explosions.map(fire => fire.remainingMs));
+            setTimeout(() => {
+                this.setState('explosions', []);
+            }, remaining);
+        }
         
         if (gameData.state) {
             this.setState('gameState', gameData.state);
@@ -372,25 +420,40 @@ export default class MultiplayerStateManager extends StateManager {
         this.setState('bombs', bombs);
     }
 
-    handleBombExploded({ bombId, explosions, map, players }) {
-        // Remove bomb
+    handleBombExploded({ bombId, bombIds, explosions, map, players, fireDurationMs }) {
+        // Remove every bomb in the chain
         const bombs = { ...this.getState('bombs') };
-        delete bombs[bombId];
+        (bombIds || [bombId]).forEach(id => delete bombs[id]);
         this.setState('bombs', bombs);
         
         // Update explosions (temporary visual effect)
         this.setState('explosions', explosions);
         
-        // Clear explosions after animation
+        // Clear explosions once the fire burns out on the server
         setTimeout(() => {
             this.setState('explosions', []);
-        }, 1000);
+        }, fireDurationMs || 1000);
         
         // Update map and players
         if (map) this.setState('gameMap', map);
         if (players) this.setState('players', players);
     }
 
+    handlePlayerHit({ playerId, lives, x, y, invulnerableMs }) {
+        const players = { ...this.getState('players') };
+        if (!players[playerId]) return;
+
+        // Track the protection on the local clock, the server one is match time
+        players[playerId] = {
+            ...players[playerId],
+            lives,
+            x,
+            y,
+            invulnerableUntil: invulnerableMs ? Date.now() + invulnerableMs : 0
+        };
+        this.setState('players', players);
+    }
+
     // Chat handlers
     handleChatMessage(chatMessage) {
         const messages = [...this.getState('chatMessages')];
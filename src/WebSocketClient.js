@@ -1,4 +1,9 @@
 // WebSocket client manager for real-time multiplayer communication
+
+// Must match PROTOCOL_VERSION in back/protocol.go; the message schema is
+// served at /protocol and kept in back/protocol.schema.json
+export const PROTOCOL_VERSION = 2;
+
 export default class WebSocketClient {
     constructor() {
         this.ws = null;
@@ -9,6 +14,7 @@ export default class WebSocketClient {
         this.messageHandlers = new Map();
         this.pingInterval = null;
         this.lastPong = Date.now();
+        this.sessionToken = null; // Issued in 'welcome', lets us resume a dropped match
         
         // Bind methods
         this.onOpen = this.onOpen.bind(this);
@@ -28,7 +34,10 @@ export default class WebSocketClient {
 
         return new Promise((resolve, reject) => {
             try {
-                const wsUrl = `ws://localhost:8080/ws?name=${encodeURIComponent(playerName)}&room=${encodeURIComponent(roomId)}`;
+                let wsUrl = `ws://localhost:8080/ws?name=${encodeURIComponent(playerName)}&room=${encodeURIComponent(roomId)}&protocol=${PROTOCOL_VERSION}`;
+                if (this.sessionToken) {
+                    wsUrl += `&token=${encodeURIComponent(this.sessionToken)}`;
+                }
                 console.log('Connecting to:', wsUrl);
                 
                 this.ws = new WebSocket(wsUrl);
@@ -82,6 +91,7 @@ export default class WebSocketClient {
         
         this.connected = false;
         this.reconnectAttempts = 0;
+        this.sessionToken = null;
     }
 
     // WebSocket event handlers
@@ -119,6 +129,24 @@ export default class WebSocketClient {
                 this.lastPong = Date.now();
                 return;
             }
+
+            // Server errors carry a code; 'error' is kept for socket errors
+            if (message.type === 'error') {
+                console.warn(`Server error ${message.data.code}: ${message.data.message}`);
+                this.emit('serverError', message.data);
+                return;
+            }
+
+            if (message.type === 'welcome' && message.data) {
+                if (message.data.protocolVersion !== PROTOCOL_VERSION) {
+                    console.warn(`Server speaks protocol ${message.data.protocolVersion}, client speaks ${PROTOCOL_VERSION}`);
+                }
+
+                // Keep the session token so a reconnect can reclaim our player
+                if (message.data.sessionToken) {
+                    this.sessionToken = message.data.sessionToken;
+                }
+            }
             
             // Emit to specific handlers
             this.emit(message.type, message);
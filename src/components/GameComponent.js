@@ -8,7 +8,6 @@ export default class GameComponent extends Component {
         this.state = {
             gameMap: this.generateInitialMap(),
             localPlayerId: null,
-            keysPressed: {},
             bombs: {},
             explosions: {},
             powerUps: {},
@@ -18,13 +17,11 @@ export default class GameComponent extends Component {
         
         this.players = props.players || {};
         this.gameState = props.gameState || 'playing';
-        this.onPlayerInput = props.onPlayerInput || (() => {});
         this.onToggleChat = props.onToggleChat || (() => {});
         
         this.TILE_SIZE = 32;
         this.MAP_WIDTH = 15;
         this.MAP_HEIGHT = 13;
-        this.MOVE_SPEED = 4;
         this.BOMB_TIMER = 3000; // 3 seconds
         this.EXPLOSION_DURATION = 1000; // 1 second
         
@@ -92,23 +89,11 @@ export default class GameComponent extends Component {
         document.addEventListener('keydown', (e) => {
             if (this.gameState !== 'playing') return;
             
-            this.state.keysPressed[e.key] = true;
-            
-            // Handle bomb placement
-            if (e.key === ' ' || e.key === 'Spacebar') {
-                e.preventDefault();
-                this.placeBomb();
-            }
-            
             // Handle chat toggle
             if (e.key === 'Enter') {
                 this.onToggleChat();
             }
         });
-        
-        document.addEventListener('keyup', (e) => {
-            this.state.keysPressed[e.key] = false;
-        });
     }
     
     startGameLoop() {
@@ -128,119 +113,14 @@ export default class GameComponent extends Component {
         requestAnimationFrame(gameLoop);
     }
     
+    // Moves and bombs are sent by MultiplayerGameLoop; the server's state is
+    // what counts
     updateGame(deltaTime) {
-        this.handleMovement();
         this.updateBombs();
         this.updateExplosions();
         this.checkCollisions();
     }
     
-    handleMovement() {
-        if (!this.state.localPlayerId) return;
-        
-        const player = this.players[this.state.localPlayerId];
-        if (!player || player.lives <= 0) return;
-        
-        let newX = player.x;
-        let newY = player.y;
-        let moved = false;
-        
-        const speed = this.MOVE_SPEED + (player.powerUps?.speed || 0);
-        
-        // Handle movement
-        if (this.state.keysPressed['ArrowLeft'] || this.state.keysPressed['a']) {
-            newX = Math.max(0, newX - speed);
-            moved = true;
-        }
-        if (this.state.keysPressed['ArrowRight'] || this.state.keysPressed['d']) {
-            newX = Math.min((this.MAP_WIDTH - 1) * this.TILE_SIZE, newX + speed);
-            moved = true;
-        }
-        if (this.state.keysPressed['ArrowUp'] || this.state.keysPressed['w']) {
-            newY = Math.max(0, newY - speed);
-            moved = true;
-        }
-        if (this.state.keysPressed['ArrowDown'] || this.state.keysPressed['s']) {
-            newY = Math.min((this.MAP_HEIGHT - 1) * this.TILE_SIZE, newY + speed);
-            moved = true;
-        }
-        
-        // Check collision with walls and blocks
-        if (moved && this.canMoveTo(newX, newY)) {
-            this.onPlayerInput({
-                type: 'move',
-                x: newX,
-                y: newY
-            });
-        }
-    }
-    
-    canMoveTo(x, y) {
-        const tileX = Math.floor(x / this.TILE_SIZE);
-        const tileY = Math.floor(y / this.TILE_SIZE);
-        
-        // Check bounds
-        if (tileX < 0 || tileX >= this.MAP_WIDTH || tileY < 0 || tileY >= this.MAP_HEIGHT) {
-            return false;
-        }
-        
-        // Check walls and blocks
-        if (this.state.gameMap[tileY] && this.state.gameMap[tileY][tileX] > 0) {
-            return false;
-        }
-        
-        // Check bombs (unless player has bomb pass power-up)
-        const player = this.players[this.state.localPlayerId];
-        if (!player?.powerUps?.bombPass) {
-            for (const bombId in this.state.bombs) {
-                const bomb = this.state.bombs[bombId];
-                const bombTileX = Math.floor(bomb.x / this.TILE_SIZE);
-                const bombTileY = Math.floor(bomb.y / this.TILE_SIZE);
-                
-                if (tileX === bombTileX && tileY === bombTileY) {
-                    return false;
-                }
-            }
-        }
-        
-        return true;
-    }
-    
-    placeBomb() {
-        if (!this.state.localPlayerId) return;
-        
-        const player = this.players[this.state.localPlayerId];
-        if (!player || player.lives <= 0) return;
-        
-        const tileX = Math.floor(player.x / this.TILE_SIZE);
-        const tileY = Math.floor(player.y / this.TILE_SIZE);
-        
-        // Check if there's already a bomb at this position
-        for (const bombId in this.state.bombs) {
-            const bomb = this.state.bombs[bombId];
-            const bombTileX = Math.floor(bomb.x / this.TILE_SIZE);
-            const bombTileY = Math.floor(bomb.y / this.TILE_SIZE);
-            
-            if (tileX === bombTileX && tileY === bombTileY) {
-                return; // Can't place bomb here
-            }
-        }
-        
-        // Check bomb limit
-        const playerBombs = Object.values(this.state.bombs).filter(bomb => bomb.playerId === this.state.localPlayerId);
-        const maxBombs = 1 + (player.powerUps?.bombs || 0);
-        
-        if (playerBombs.length >= maxBombs) {
-            return; // Too many bombs
-        }
-        
-        this.onPlayerInput({
-            type: 'bomb',
-            x: tileX * this.TILE_SIZE,
-            y: tileY * this.TILE_SIZE
-        });
-    }
-    
     updateBombs() {
         const currentTime = Date.now();
         
@@ -310,9 +190,6 @@ export default class GameComponent extends Component {
         
         // Remove bomb
         delete this.state.bombs[bombId];
-        
-        // Check for player damage
-        this.checkExplosionDamage(explosionTiles);
     }
     
     destroyBlock(x, y) {
@@ -332,25 +209,6 @@ export default class GameComponent extends Component {
         }
     }
     
-    checkExplosionDamage(explosionTiles) {
-        // Check if any players are in the explosion
-        for (const playerId in this.players) {
-            const player = this.players[playerId];
-            if (player.lives <= 0) continue;
-            
-            const playerTileX = Math.floor(player.x / this.TILE_SIZE);
-            const playerTileY = Math.floor(player.y / this.TILE_SIZE);
-            
-            if (explosionTiles.some(tile => tile.x === playerTileX && tile.y === playerTileY)) {
-                this.onPlayerInput({
-                    type: 'damage',
-                    playerId: playerId,
-                    damage: 1
-                });
-            }
-        }
-    }
-    
     updateExplosions() {
         const currentTime = Date.now();
         
@@ -378,13 +236,8 @@ export default class GameComponent extends Component {
             const powerUpTileX = Math.floor(powerUp.x / this.TILE_SIZE);
             const powerUpTileY = Math.floor(powerUp.y / this.TILE_SIZE);
             
+            // The server decides pickups; this only hides the local power-up
             if (playerTileX === powerUpTileX && playerTileY === powerUpTileY) {
-                this.onPlayerInput({
-                    type: 'powerUp',
-                    powerUpType: powerUp.type,
-                    powerUpId: powerUpId
-                });
-                
                 delete this.state.powerUps[powerUpId];
             }
         }
@@ -48,6 +48,7 @@ function createInput(divTile, level, startGameCallback) {
   inputField.style.borderRadius = '5px';
   inputField.style.border = '1px solid #ccc';
   inputField.style.width = '200px';
+  inputField.maxLength = 20; // Longueur maximale acceptée par le serveur
 
   const submitButton = document.createElement('button');
   submitButton.textContent = 'Valider';